@@ -0,0 +1,72 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// bisectCmd represents the bisect command
+var bisectCmd = &cobra.Command{
+	Use:   "bisect",
+	Short: "cronicle bisect finds the commit that broke a task",
+	Long: `bisect clones the repo of a task into a scratch path and executes the task
+at successive midpoints of the first parent history between a good and a bad commit,
+with the same ${date} substitutions for the time given by --time, to find the first
+commit at which the task fails.
+
+For example to find the commit that broke task "bar" in schedule "foo":
+	cronicle bisect --schedule foo --task bar --good 3f2a1b4 --bad master --time 2020-10-01T00:00:00-08:00`,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, _ := cmd.Flags().GetString("path")
+		task, _ := cmd.Flags().GetString("task")
+		schedule, _ := cmd.Flags().GetString("schedule")
+		good, _ := cmd.Flags().GetString("good")
+		bad, _ := cmd.Flags().GetString("bad")
+		timeFlag, _ := cmd.Flags().GetString("time")
+
+		t := time.Now()
+		if timeFlag != "" {
+			n, err := time.Parse(time.RFC3339, timeFlag)
+			if err != nil {
+				log.Fatal(err)
+			}
+			t = n
+		}
+
+		if err := cronicle.PrintBisect(os.Stdout, path, schedule, task, good, bad, t); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bisectCmd)
+	bisectCmd.Flags().String("path", "./cronicle.hcl", "Path to a cronicle.hcl file")
+	bisectCmd.Flags().String("schedule", "", "Name of the schedule that contains the task (required)")
+	bisectCmd.Flags().String("task", "", "Name of the task to bisect (required)")
+	bisectCmd.Flags().String("good", "", "Commit hash or revision at which the task succeeds (required)")
+	bisectCmd.Flags().String("bad", "HEAD", "Commit hash or revision at which the task fails")
+	bisectCmd.Flags().String("time", "", "Timestamp to execute the task at [2006-01-02T15:04:05-08:00], defaults to now")
+	bisectCmd.MarkFlagRequired("schedule")
+	bisectCmd.MarkFlagRequired("task")
+	bisectCmd.MarkFlagRequired("good")
+}
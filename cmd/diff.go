@@ -0,0 +1,53 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <commitA> <commitB>",
+	Short: "cronicle diff shows the schedule and task changes between two commits of cronicle.hcl",
+	Long: `diff parses the cronicle.hcl at two commits of the repo that tracks it and lists
+the schedules and tasks that were added, removed or changed, with the old and new value
+of each changed property. Commits may be given as any git revision, i.e. a hash, branch or tag.
+
+For example to show the changes of the last commit:
+	cronicle diff HEAD~1 HEAD --path cronicle.hcl
+
+Accepted reloads of cronicle run are recorded in path/.cronicle/audit.log.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		path, _ := cmd.Flags().GetString("path")
+		output, _ := cmd.Flags().GetString("output")
+
+		if err := cronicle.PrintConfigDiff(os.Stdout, path, args[0], args[1], output); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().String("path", "./cronicle.hcl", "Path to a cronicle.hcl file")
+	diffCmd.Flags().String("output", "text", "Output format [text, json]")
+}
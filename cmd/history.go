@@ -0,0 +1,81 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "cronicle history lists past schedule runs and task attempts",
+	Long: `history reads the run history recorded by cronicle run and cronicle exec
+in path/.cronicle/history.db. Every schedule run and task attempt is recorded with
+its scheduled time, start/end, exit status, git commit and attempt number.
+
+For example to list the failed runs of task "bar" in schedule "foo" from last week:
+	cronicle history --schedule foo --task bar --status failed --since 2020-10-01T00:00:00-08:00 --until 2020-10-08T00:00:00-08:00
+
+Use --output json to get the full records.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, _ := cmd.Flags().GetString("path")
+		task, _ := cmd.Flags().GetString("task")
+		schedule, _ := cmd.Flags().GetString("schedule")
+		status, _ := cmd.Flags().GetString("status")
+		sinceFlag, _ := cmd.Flags().GetString("since")
+		untilFlag, _ := cmd.Flags().GetString("until")
+		limit, _ := cmd.Flags().GetInt("limit")
+		output, _ := cmd.Flags().GetString("output")
+
+		filter := cronicle.HistoryFilter{Schedule: schedule, Task: task, Status: status, Limit: limit}
+		if sinceFlag != "" {
+			since, err := time.Parse(time.RFC3339, sinceFlag)
+			if err != nil {
+				log.Fatal(err)
+			}
+			filter.Since = since
+		}
+		if untilFlag != "" {
+			until, err := time.Parse(time.RFC3339, untilFlag)
+			if err != nil {
+				log.Fatal(err)
+			}
+			filter.Until = until
+		}
+
+		if err := cronicle.PrintHistory(os.Stdout, path, filter, output); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.Flags().String("path", "./cronicle.hcl", "Path to a cronicle.hcl file")
+	historyCmd.Flags().String("schedule", "", "Only list runs of the named schedule")
+	historyCmd.Flags().String("task", "", "Only list attempts of the named task")
+	historyCmd.Flags().String("status", "", "Only list runs with the given status [success, failed, timeout, skipped]")
+	historyCmd.Flags().String("since", "", "Only list runs scheduled at or after the timestamp [2006-01-02T15:04:05-08:00]")
+	historyCmd.Flags().String("until", "", "Only list runs scheduled at or before the timestamp [2006-01-02T15:04:05-08:00]")
+	historyCmd.Flags().Int("limit", 50, "Maximum number of records to list, newest first. 0 lists all records")
+	historyCmd.Flags().String("output", "table", "Output format [table, json]")
+}
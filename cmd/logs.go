@@ -0,0 +1,81 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "cronicle logs prints the output of a task run",
+	Long: `logs prints the stdout/stderr of a task run kept by cronicle run and cronicle exec
+in path/.cronicle/runs/<schedule>/<task>/<scheduled-time>/<attempt>.log
+
+For example to print the latest run of task "bar" in schedule "foo":
+	cronicle logs --schedule foo --task bar
+To print the run scheduled at a given time, and follow it while it is executing:
+	cronicle logs --schedule foo --task bar --time 2020-10-01T00:00:00-08:00 --follow
+
+Run logs are pruned by the run_logs {} retention and max_runs attributes.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, _ := cmd.Flags().GetString("path")
+		task, _ := cmd.Flags().GetString("task")
+		schedule, _ := cmd.Flags().GetString("schedule")
+		timeFlag, _ := cmd.Flags().GetString("time")
+		follow, _ := cmd.Flags().GetBool("follow")
+
+		var t time.Time
+		if timeFlag != "" {
+			n, err := time.Parse(time.RFC3339, timeFlag)
+			if err != nil {
+				log.Fatal(err)
+			}
+			t = n
+		}
+
+		stop := make(chan struct{})
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			close(stop)
+		}()
+
+		if err := cronicle.PrintRunLogs(os.Stdout, path, schedule, task, t, follow, stop); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.Flags().String("path", "./cronicle.hcl", "Path to a cronicle.hcl file")
+	logsCmd.Flags().String("schedule", "", "Name of the schedule that contains the task (required)")
+	logsCmd.Flags().String("task", "", "Name of the task to print the run logs of (required)")
+	logsCmd.Flags().String("time", "", "Scheduled time of the run, defaults to the latest run [2006-01-02T15:04:05-08:00]")
+	logsCmd.Flags().BoolP("follow", "f", false, "Follow the log of the last attempt as it is written")
+	logsCmd.MarkFlagRequired("schedule")
+	logsCmd.MarkFlagRequired("task")
+}
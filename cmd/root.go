@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/jshiv/cronicle/internal/cronicle"
 	"github.com/spf13/cobra"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -71,6 +72,7 @@ func Execute() {
 
 func init() {
 	cobra.OnInitialize(initConfig)
+	rootCmd.Version = cronicle.Version
 
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
@@ -16,6 +16,7 @@ limitations under the License.
 package cmd
 
 import (
+	"os"
 	"path/filepath"
 	"strings"
 
@@ -45,8 +46,17 @@ The run command will log schedule information to stdout including git commit inf
 		cron, _ := cmd.Flags().GetString("cron")
 		command, _ := cmd.Flags().GetString("command")
 		logToFile, _ := cmd.Flags().GetBool("log-to-file")
+		api, _ := cmd.Flags().GetString("api")
+		apiToken, _ := cmd.Flags().GetString("api-token")
+		if apiToken == "" {
+			apiToken = os.Getenv("CRONICLE_API_TOKEN")
+		}
+		metrics, _ := cmd.Flags().GetString("metrics")
+		labels, _ := cmd.Flags().GetStringSlice("labels")
+		maxConcurrent, _ := cmd.Flags().GetInt("max-concurrent")
+		drainTimeout, _ := cmd.Flags().GetDuration("drain-timeout")
 
-		runOptions := cronicle.RunOptions{RunWorker: runWorker, QueueType: queueType, QueueName: queueName, Addr: addr, LogToFile: logToFile}
+		runOptions := cronicle.RunOptions{RunWorker: runWorker, QueueType: queueType, QueueName: queueName, Addr: addr, LogToFile: logToFile, API: api, APIToken: apiToken, Metrics: metrics, Labels: labels, MaxConcurrent: maxConcurrent, DrainTimeout: drainTimeout}
 
 		if cron != "" && command != "" {
 			conf := cronicle.Default()
@@ -87,6 +97,12 @@ func init() {
 	runCmd.Flags().String("cron", "", "crontab expression for running a command e.g. @every 1h")
 	runCmd.Flags().String("command", "", "command to run on the given cron [/bin/echo cronicle]")
 	runCmd.Flags().Bool("log-to-file", false, "log to path/.cronicle/log/cronicle.log")
+	runCmd.Flags().String("api", "", "host:port to serve the http api to list, trigger and pause schedules e.g. :8080 on 127.0.0.1")
+	runCmd.Flags().String("api-token", "", "bearer token the api requests must carry [default: $CRONICLE_API_TOKEN]")
+	runCmd.Flags().String("metrics", "", "host:port to serve prometheus metrics at /metrics e.g. :9090")
+	runCmd.Flags().StringSlice("labels", nil, "labels of the worker thread, it runs the schedules whose run_on labels it has e.g. gpu,us-east")
+	runCmd.Flags().Int("max-concurrent", 0, "max schedule runs the worker thread executes at once, 0 is unbounded. A saturated nsq worker still holds up to two queued messages per queue")
+	runCmd.Flags().Duration("drain-timeout", cronicle.DefaultDrainTimeout, "time to wait for the runs in flight on SIGTERM before they are cancelled")
 
 	// Here you will define your flags and configuration settings.
 
@@ -52,9 +52,13 @@ Multipule workers can be started, they will take turns consuming from the queue.
 		queueType, _ := cmd.Flags().GetString("queue")
 		queueName, _ := cmd.Flags().GetString("queue-name")
 		addr, _ := cmd.Flags().GetString("addr")
+		metrics, _ := cmd.Flags().GetString("metrics")
+		labels, _ := cmd.Flags().GetStringSlice("labels")
+		maxConcurrent, _ := cmd.Flags().GetInt("max-concurrent")
+		drainTimeout, _ := cmd.Flags().GetDuration("drain-timeout")
 
 		log.Info("Starting Worker from: " + path)
-		runOptions := cronicle.RunOptions{RunWorker: true, QueueType: queueType, QueueName: queueName, Addr: addr}
+		runOptions := cronicle.RunOptions{RunWorker: true, QueueType: queueType, QueueName: queueName, Addr: addr, Metrics: metrics, Labels: labels, MaxConcurrent: maxConcurrent, DrainTimeout: drainTimeout}
 		cronicle.StartWorker(path, runOptions)
 	},
 }
@@ -81,6 +85,10 @@ func init() {
 	Configurable via the queue.addr field in cronicle.hcl
 	`
 	workerCmd.Flags().String("addr", "", addrDesc)
+	workerCmd.Flags().String("metrics", "", "host:port to serve prometheus metrics at /metrics e.g. :9090")
+	workerCmd.Flags().StringSlice("labels", nil, "labels of the worker, it runs the schedules whose run_on labels it has e.g. gpu,us-east")
+	workerCmd.Flags().Int("max-concurrent", 0, "max schedule runs the worker executes at once, 0 is unbounded. A saturated nsq worker still holds up to two queued messages per queue")
+	workerCmd.Flags().Duration("drain-timeout", cronicle.DefaultDrainTimeout, "time to wait for the runs in flight on SIGTERM before they are cancelled")
 
 	// Here you will define your flags and configuration settings.
 
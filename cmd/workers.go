@@ -0,0 +1,53 @@
+/*
+Copyright © 2020 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// workersCmd represents the workers command
+var workersCmd = &cobra.Command{
+	Use:   "workers",
+	Short: "cronicle workers lists the workers registered with cronicle run",
+	Long: `workers lists the workers that heartbeat to cronicle run, recorded in
+path/.cronicle/history.db. Each worker is listed with its version, labels, the time
+since its last heartbeat and the schedules it is running. A worker without a heartbeat
+for 30s is listed as dead.
+
+For example:
+	cronicle workers --path cronicle.hcl --output json
+
+The running scheduler serves the same list at GET /api/workers with cronicle run --api.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, _ := cmd.Flags().GetString("path")
+		output, _ := cmd.Flags().GetString("output")
+
+		if err := cronicle.PrintWorkers(os.Stdout, path, output); err != nil {
+			log.Fatal(err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(workersCmd)
+	workersCmd.Flags().String("path", "./cronicle.hcl", "Path to a cronicle.hcl file")
+	workersCmd.Flags().String("output", "table", "Output format [table, json]")
+}
@@ -0,0 +1,339 @@
+package cronicle
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	cron "github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+//scheduler is the state of the running cron scheduler that is shared with the api server
+type scheduler struct {
+	mu      sync.Mutex
+	conf    *Config
+	cron    *cron.Cron
+	queue   chan<- []byte
+	entries map[string]cron.EntryID
+	paused  map[string]bool
+}
+
+//schedulerGlobal is the scheduler started by StartCron
+var schedulerGlobal = &scheduler{entries: map[string]cron.EntryID{}, paused: map[string]bool{}}
+
+//start sets the cron and queue the schedules are produced to
+func (s *scheduler) start(c *cron.Cron, queue chan<- []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cron = c
+	s.queue = queue
+}
+
+//stop stops the cron so that no further schedules are produced
+func (s *scheduler) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cron != nil {
+		s.cron.Stop()
+	}
+}
+
+//load sets the loaded config and the cron entry of each schedule
+func (s *scheduler) load(conf *Config, entries map[string]cron.EntryID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conf = conf
+	s.entries = entries
+}
+
+//loaded returns the loaded config and a copy of the cron entry of each schedule
+func (s *scheduler) loaded() (*Config, map[string]cron.EntryID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := map[string]cron.EntryID{}
+	for name, id := range s.entries {
+		entries[name] = id
+	}
+	return s.conf, entries
+}
+
+func (s *scheduler) isPaused(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused[name]
+}
+
+//setPaused pauses or resumes the cron of the named schedule
+func (s *scheduler) setPaused(name string, paused bool) error {
+	if _, ok := s.schedule(name); !ok {
+		return fmt.Errorf("schedule %q not found", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if paused {
+		s.paused[name] = true
+	} else {
+		delete(s.paused, name)
+	}
+	return nil
+}
+
+//schedule returns the named schedule of the loaded config
+func (s *scheduler) schedule(name string) (Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conf == nil {
+		return Schedule{}, false
+	}
+	for _, schedule := range s.conf.Schedules {
+		if schedule.Name == name {
+			return schedule, true
+		}
+	}
+	return Schedule{}, false
+}
+
+//produce returns the cron func of a schedule, which produces the schedule unless it is paused.
+//The schedule of the loaded config is produced, which carries the commit of the latest reload.
+func (s *scheduler) produce(schedule Schedule, queue chan<- []byte) func() {
+	return func() {
+		if s.isPaused(schedule.Name) {
+			log.WithFields(log.Fields{"schedule": schedule.Name}).Info("Paused, skip execution")
+			return
+		}
+		produced := schedule
+		if loaded, ok := s.schedule(schedule.Name); ok {
+			produced = loaded
+		}
+		ProduceSchedule(produced, queue)()
+	}
+}
+
+//ScheduleStatus is the api view of a loaded schedule and its next and previous cron fire times
+type ScheduleStatus struct {
+	Name     string
+	Cron     string
+	Timezone string
+	Paused   bool
+	Next     *time.Time `json:",omitempty"`
+	Prev     *time.Time `json:",omitempty"`
+	Tasks    []TaskStatus
+}
+
+//TaskStatus is the api view of a task in a loaded schedule
+type TaskStatus struct {
+	Name        string
+	Command     []string
+	Depends     []string
+	TriggerRule string
+	ForEach     []string
+}
+
+//statuses returns the ScheduleStatus of each schedule in the loaded config
+func (s *scheduler) statuses() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	statuses := []ScheduleStatus{}
+	if s.conf == nil {
+		return statuses
+	}
+	for _, schedule := range s.conf.Schedules {
+		status := ScheduleStatus{
+			Name:     schedule.Name,
+			Cron:     schedule.Cron,
+			Timezone: schedule.Timezone,
+			Paused:   s.paused[schedule.Name],
+			Tasks:    []TaskStatus{},
+		}
+		if id, ok := s.entries[schedule.Name]; ok && s.cron != nil {
+			entry := s.cron.Entry(id)
+			if !entry.Next.IsZero() {
+				status.Next = &entry.Next
+			}
+			if !entry.Prev.IsZero() {
+				status.Prev = &entry.Prev
+			}
+		}
+		for _, task := range schedule.Tasks {
+			status.Tasks = append(status.Tasks, TaskStatus{
+				Name:        task.Name,
+				Command:     task.Command,
+				Depends:     task.Depends,
+				TriggerRule: task.TriggerRule,
+				ForEach:     task.ForEach,
+			})
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+//trigger produces the named schedule at t, or only the named task of the schedule if taskName is given.
+func (s *scheduler) trigger(scheduleName string, taskName string, t time.Time) error {
+	schedule, ok := s.schedule(scheduleName)
+	if !ok {
+		return fmt.Errorf("schedule %q not found", scheduleName)
+	}
+	if taskName != "" {
+		task, ok := schedule.TaskMap()[taskName]
+		if !ok {
+			return fmt.Errorf("task %q not found in schedule %q", taskName, scheduleName)
+		}
+		task.Depends = nil
+		schedule.Tasks = []Task{task}
+	}
+	s.mu.Lock()
+	queue := s.queue
+	s.mu.Unlock()
+	if queue == nil {
+		return fmt.Errorf("the scheduler is not started")
+	}
+	log.WithFields(log.Fields{"schedule": scheduleName, "task": taskName, "api": "trigger"}).Info("Triggered")
+	ProduceScheduleAt(schedule, queue, t)
+	return nil
+}
+
+//APIHandler returns the http.Handler of the cronicle run api.
+//	GET  /api/schedules                                  lists the schedules and their next fire time
+//	GET  /api/schedules/<schedule>                       shows a schedule
+//	POST /api/schedules/<schedule>/trigger               queues the schedule
+//	POST /api/schedules/<schedule>/tasks/<task>/trigger  queues a single task of the schedule
+//	POST /api/schedules/<schedule>/pause                 skips the cron of the schedule until resumed
+//	POST /api/schedules/<schedule>/resume                resumes the cron of the schedule
+//	GET  /api/workers                                    lists the workers with their state and runs in flight
+//The trigger endpoints accept ?time=2006-01-02T15:04:05-08:00 to set the execution time.
+func APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/schedules", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+			return
+		}
+		writeJSON(w, http.StatusOK, schedulerGlobal.statuses())
+	})
+	mux.HandleFunc("/api/schedules/", handleSchedule)
+	mux.HandleFunc("/api/workers", handleWorkers)
+	return mux
+}
+
+//RequireToken returns a handler that serves the requests of h with the header
+//"Authorization: Bearer <token>" and rejects all others, an empty token allows all requests.
+func RequireToken(token string, h http.Handler) http.Handler {
+	if token == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cronicle"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("a valid bearer token is required"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+//apiAddr binds an addr without a host, i.e. ":8080", to the loopback interface
+func apiAddr(addr string) string {
+	if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		return net.JoinHostPort("127.0.0.1", port)
+	}
+	return addr
+}
+
+//ServeAPI serves the cronicle run api at addr, i.e. ":8080" serves 127.0.0.1:8080 and "0.0.0.0:8080"
+//all interfaces. If token is given each request must carry it as a bearer token.
+func ServeAPI(addr string, token string) {
+	addr = apiAddr(addr)
+	logger := log.WithFields(log.Fields{"cronicle": "api", "addr": addr})
+	if host, _, _ := net.SplitHostPort(addr); token == "" && !isLoopback(host) {
+		logger.Warn("The API can trigger and pause schedules, serving it without --api-token on a non loopback address")
+	}
+	logger.Info("Starting API...")
+	if err := http.ListenAndServe(addr, RequireToken(token, APIHandler())); err != nil {
+		logger.Error(err)
+	}
+}
+
+//isLoopback reports whether host is localhost or a loopback ip
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+//handleSchedule routes the /api/schedules/<schedule>/... endpoints
+func handleSchedule(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/schedules/"), "/"), "/")
+	name := parts[0]
+
+	method := http.MethodPost
+	if len(parts) == 1 {
+		method = http.MethodGet
+	}
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	var err error
+	switch {
+	case len(parts) == 1:
+		for _, status := range schedulerGlobal.statuses() {
+			if status.Name == name {
+				writeJSON(w, http.StatusOK, status)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, fmt.Errorf("schedule %q not found", name))
+		return
+	case len(parts) == 2 && parts[1] == "trigger":
+		err = triggerRequest(r, name, "")
+	case len(parts) == 4 && parts[1] == "tasks" && parts[3] == "trigger":
+		err = triggerRequest(r, name, parts[2])
+	case len(parts) == 2 && parts[1] == "pause":
+		err = schedulerGlobal.setPaused(name, true)
+	case len(parts) == 2 && parts[1] == "resume":
+		err = schedulerGlobal.setPaused(name, false)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s not found", r.URL.Path))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]string{"Schedule": name, "Status": parts[len(parts)-1]})
+}
+
+//triggerRequest triggers the schedule or task at the ?time= of the request, defaulting to now
+func triggerRequest(r *http.Request, scheduleName string, taskName string) error {
+	t := time.Now()
+	if timeParam := r.URL.Query().Get("time"); timeParam != "" {
+		var err error
+		if t, err = time.Parse(time.RFC3339, timeParam); err != nil {
+			return err
+		}
+	}
+	return schedulerGlobal.trigger(scheduleName, taskName, t)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.WithFields(log.Fields{"cronicle": "api"}).Error(err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"Error": err.Error()})
+}
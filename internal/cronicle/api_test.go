@@ -0,0 +1,115 @@
+package cronicle_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API", func() {
+	var apiPath string
+	var queue chan []byte
+	var handler http.Handler
+
+	request := func(method string, target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+		return w
+	}
+
+	BeforeEach(func() {
+		apiPath, _ = filepath.Abs("./test_api/")
+		os.MkdirAll(apiPath, 0777)
+		hcl := `schedule "foo" {
+  cron = "@every 1h"
+  task "bar" {
+    command = ["/bin/echo", "bar"]
+  }
+  task "baz" {
+    command = ["/bin/echo", "baz"]
+    depends = ["bar"]
+  }
+}
+`
+		cronicleFile := filepath.Join(apiPath, "cronicle.hcl")
+		Expect(ioutil.WriteFile(cronicleFile, []byte(hcl), 0644)).To(BeNil())
+		queue = make(chan []byte, 1)
+		cronicle.StartCron(cronicleFile, queue)
+		handler = cronicle.APIHandler()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(apiPath)
+	})
+
+	It("GET /api/schedules should list the schedules with their next fire time", func() {
+		w := request("GET", "/api/schedules")
+		Expect(w.Code).To(Equal(http.StatusOK))
+		var statuses []cronicle.ScheduleStatus
+		Expect(json.Unmarshal(w.Body.Bytes(), &statuses)).To(BeNil())
+		Expect(len(statuses)).To(Equal(1))
+		Expect(statuses[0].Name).To(Equal("foo"))
+		Expect(statuses[0].Next).ToNot(BeNil())
+		Expect(statuses[0].Next.Sub(time.Now()).Minutes()).To(BeNumerically("~", 60, 1))
+		Expect(len(statuses[0].Tasks)).To(Equal(2))
+
+		Expect(request("GET", "/api/schedules/foo").Code).To(Equal(http.StatusOK))
+		Expect(request("GET", "/api/schedules/qux").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("POST /api/schedules/<schedule>/trigger should queue the schedule at the given time", func() {
+		w := request("POST", "/api/schedules/foo/trigger?time=2020-11-01T22:08:41Z")
+		Expect(w.Code).To(Equal(http.StatusAccepted))
+		_, schedule, err := cronicle.DecodeEnvelope(<-queue)
+		Expect(err).To(BeNil())
+		Expect(schedule.Name).To(Equal("foo"))
+		Expect(schedule.Now.UTC().Format(time.RFC3339)).To(Equal("2020-11-01T22:08:41Z"))
+		Expect(len(schedule.Tasks)).To(Equal(2))
+		last, err := cronicle.NewHistory(apiPath).LastFire("foo")
+		Expect(err).To(BeNil())
+		Expect(last.UTC().Format(time.RFC3339)).To(Equal("2020-11-01T22:08:41Z"))
+
+		Expect(request("GET", "/api/schedules/foo/trigger").Code).To(Equal(http.StatusMethodNotAllowed))
+		Expect(request("POST", "/api/schedules/qux/trigger").Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("POST /api/schedules/<schedule>/tasks/<task>/trigger should queue only the task", func() {
+		w := request("POST", "/api/schedules/foo/tasks/baz/trigger")
+		Expect(w.Code).To(Equal(http.StatusAccepted))
+		_, schedule, err := cronicle.DecodeEnvelope(<-queue)
+		Expect(err).To(BeNil())
+		Expect(len(schedule.Tasks)).To(Equal(1))
+		Expect(schedule.Tasks[0].Name).To(Equal("baz"))
+		Expect(schedule.Tasks[0].Depends).To(BeNil())
+	})
+
+	It("POST /api/schedules/<schedule>/pause and resume should toggle the paused state", func() {
+		Expect(request("POST", "/api/schedules/foo/pause").Code).To(Equal(http.StatusAccepted))
+		var status cronicle.ScheduleStatus
+		Expect(json.Unmarshal(request("GET", "/api/schedules/foo").Body.Bytes(), &status)).To(BeNil())
+		Expect(status.Paused).To(BeTrue())
+
+		Expect(request("POST", "/api/schedules/foo/resume").Code).To(Equal(http.StatusAccepted))
+		Expect(json.Unmarshal(request("GET", "/api/schedules/foo").Body.Bytes(), &status)).To(BeNil())
+		Expect(status.Paused).To(BeFalse())
+	})
+
+	It("cronicle.RequireToken should reject the requests without the bearer token", func() {
+		handler = cronicle.RequireToken("secret", cronicle.APIHandler())
+		Expect(request("GET", "/api/schedules").Code).To(Equal(http.StatusUnauthorized))
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/api/schedules", nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		handler.ServeHTTP(w, r)
+		Expect(w.Code).To(Equal(http.StatusOK))
+	})
+})
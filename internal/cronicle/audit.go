@@ -0,0 +1,415 @@
+package cronicle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+//Change kinds of a ScheduleChange or TaskChange
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+var (
+	auditBucket      = []byte("audit")
+	auditStateBucket = []byte("audit-state")
+	auditStateKey    = []byte("last")
+)
+
+//AuditRecord is an accepted reload of cronicle.hcl, kept in the history store
+//and appended as a json line to croniclePath/.cronicle/audit.log
+type AuditRecord struct {
+	ID   uint64
+	Time time.Time
+	//OldCommit and NewCommit are the commits of the config repo before and after the reload,
+	//Author is the author of NewCommit. They are empty if the config is not tracked by a repo.
+	OldCommit string
+	NewCommit string
+	Author    string
+	Changes   []ScheduleChange
+}
+
+//ScheduleChange is a schedule that was added, removed or changed between two configs
+type ScheduleChange struct {
+	Schedule string
+	Change   string
+	Fields   []FieldChange `json:",omitempty"`
+	Tasks    []TaskChange  `json:",omitempty"`
+}
+
+//TaskChange is a task that was added, removed or changed within a schedule
+type TaskChange struct {
+	Task   string
+	Change string
+	Fields []FieldChange `json:",omitempty"`
+}
+
+//FieldChange is a schedule or task property with its old and new json values
+type FieldChange struct {
+	Field string
+	Old   string
+	New   string
+}
+
+//auditIgnoredFields are the properties that are not part of the definition of a schedule or task
+var auditIgnoredFields = map[string]bool{
+	"Name":         true,
+	"Tasks":        true,
+	"Now":          true,
+	"Git":          true,
+	"Path":         true,
+	"CroniclePath": true,
+	"ScheduleName": true,
+}
+
+//DiffConfigs returns the schedules and tasks that were added, removed or changed from
+//prior to conf, with the changed properties of each. A nil prior has no schedules.
+func DiffConfigs(prior *Config, conf *Config) []ScheduleChange {
+	changes := []ScheduleChange{}
+	priorSchedules := map[string]Schedule{}
+	if prior != nil {
+		for _, schedule := range prior.Schedules {
+			priorSchedules[schedule.Name] = schedule
+		}
+	}
+	names := map[string]bool{}
+	for _, schedule := range conf.Schedules {
+		names[schedule.Name] = true
+		priorSchedule, ok := priorSchedules[schedule.Name]
+		if !ok {
+			changes = append(changes, ScheduleChange{Schedule: schedule.Name, Change: ChangeAdded})
+			continue
+		}
+		fields := fieldChanges(priorSchedule, schedule)
+		tasks := diffTasks(priorSchedule.Tasks, schedule.Tasks)
+		if len(fields) > 0 || len(tasks) > 0 {
+			changes = append(changes, ScheduleChange{Schedule: schedule.Name, Change: ChangeChanged, Fields: fields, Tasks: tasks})
+		}
+	}
+	if prior != nil {
+		for _, schedule := range prior.Schedules {
+			if !names[schedule.Name] {
+				changes = append(changes, ScheduleChange{Schedule: schedule.Name, Change: ChangeRemoved})
+			}
+		}
+	}
+	return changes
+}
+
+//diffTasks returns the tasks that were added, removed or changed from prior to tasks
+func diffTasks(prior []Task, tasks []Task) []TaskChange {
+	changes := []TaskChange{}
+	priorTasks := map[string]Task{}
+	for _, task := range prior {
+		priorTasks[task.Name] = task
+	}
+	names := map[string]bool{}
+	for _, task := range tasks {
+		names[task.Name] = true
+		priorTask, ok := priorTasks[task.Name]
+		if !ok {
+			changes = append(changes, TaskChange{Task: task.Name, Change: ChangeAdded})
+			continue
+		}
+		if fields := fieldChanges(priorTask, task); len(fields) > 0 {
+			changes = append(changes, TaskChange{Task: task.Name, Change: ChangeChanged, Fields: fields})
+		}
+	}
+	for _, task := range prior {
+		if !names[task.Name] {
+			changes = append(changes, TaskChange{Task: task.Name, Change: ChangeRemoved})
+		}
+	}
+	return changes
+}
+
+//fieldChanges compares the json properties of two schedules or two tasks, notify
+//passwords are redacted so that they are not written to the audit log
+func fieldChanges(prior interface{}, v interface{}) []FieldChange {
+	priorFields, fields := jsonFields(prior), jsonFields(v)
+	keys := []string{}
+	for k := range fields {
+		if !auditIgnoredFields[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	changes := []FieldChange{}
+	for _, k := range keys {
+		if string(priorFields[k]) != string(fields[k]) {
+			changes = append(changes, FieldChange{Field: k, Old: string(priorFields[k]), New: string(fields[k])})
+		}
+	}
+	return changes
+}
+
+//jsonFields returns the json value of each property of v
+func jsonFields(v interface{}) map[string]json.RawMessage {
+	fields := map[string]json.RawMessage{}
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Error(err)
+		return fields
+	}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		log.Error(err)
+	}
+	return fields
+}
+
+//RecordAudit appends rec to the audit history and assigns rec.ID
+func (h *History) RecordAudit(rec *AuditRecord) error {
+	return h.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(auditBucket)
+		if err != nil {
+			return err
+		}
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		rec.ID = id
+		v, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(id), v)
+	})
+}
+
+//Audits returns the audit records, newest first. limit caps the number of records, 0 returns all.
+func (h *History) Audits(limit int) ([]AuditRecord, error) {
+	records := []AuditRecord{}
+	err := h.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(auditBucket)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var rec AuditRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			records = append(records, rec)
+			if limit > 0 && len(records) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+//auditState is the config of the last accepted reload, kept in the history store so that
+//the first reload after a restart is audited against the config that was running before.
+type auditState struct {
+	Commit    string
+	Schedules []Schedule
+}
+
+//auditState returns the state of the last audited reload, or nil if there is none
+func (h *History) auditState() (*auditState, error) {
+	var state *auditState
+	err := h.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(auditStateBucket)
+		if b == nil {
+			return nil
+		}
+		v := b.Get(auditStateKey)
+		if v == nil {
+			return nil
+		}
+		state = &auditState{}
+		return json.Unmarshal(v, state)
+	})
+	return state, err
+}
+
+//setAuditState persists the state of the last audited reload
+func (h *History) setAuditState(state auditState) error {
+	return h.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(auditStateBucket)
+		if err != nil {
+			return err
+		}
+		v, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		return b.Put(auditStateKey, v)
+	})
+}
+
+//auditReload records the changes of an accepted reload of conf, from the config of the last
+//audited reload, in the history store and the audit log of croniclePath.
+//Reloads without changes are not recorded.
+func auditReload(croniclePath string, conf *Config) {
+	h := NewHistory(croniclePath)
+	fields := log.Fields{"cronicle": "audit"}
+	state, err := h.auditState()
+	if err != nil {
+		log.WithFields(fields).Error(err)
+	}
+	var prior *Config
+	rec := AuditRecord{Time: time.Now(), NewCommit: conf.Commit}
+	if state != nil {
+		prior = &Config{Schedules: state.Schedules}
+		rec.OldCommit = state.Commit
+	}
+	rec.Changes = DiffConfigs(prior, conf)
+	if conf.Commit != "" {
+		if r, err := git.PlainOpen(croniclePath); err == nil {
+			if c, err := r.CommitObject(plumbing.NewHash(conf.Commit)); err == nil {
+				rec.Author = c.Author.Email
+			}
+		}
+	}
+	unchanged := len(rec.Changes) == 0 && rec.OldCommit == rec.NewCommit
+	if unchanged && state != nil {
+		return
+	}
+
+	next := auditState{Commit: rec.NewCommit}
+	for _, schedule := range conf.Schedules {
+		schedule.Tasks = append([]Task{}, schedule.Tasks...)
+		schedule.CleanGit()
+		next.Schedules = append(next.Schedules, schedule)
+	}
+	if err := h.setAuditState(next); err != nil {
+		log.WithFields(fields).Error(err)
+	}
+	if unchanged {
+		return
+	}
+
+	fields = log.Fields{"cronicle": "audit", "old": shortHash(rec.OldCommit), "new": shortHash(rec.NewCommit), "author": rec.Author}
+	if err := h.RecordAudit(&rec); err != nil {
+		log.WithFields(fields).Error(err)
+	}
+	if err := appendAuditLog(filepath.Join(croniclePath, ".cronicle", "audit.log"), rec); err != nil {
+		log.WithFields(fields).Error(err)
+	}
+	log.WithFields(fields).Info(fmt.Sprintf("Config changed, %d schedules added, removed or changed", len(rec.Changes)))
+}
+
+//appendAuditLog appends rec as a json line to the audit log at path
+func appendAuditLog(path string, rec AuditRecord) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(rec)
+}
+
+//ConfigAt parses the cronicle.hcl at the given path as of the given commit, or any
+//revision understood by git rev-parse, of the repo containing the file.
+func ConfigAt(cronicleFile string, revision string) (*Config, error) {
+	cronicleFileAbs, err := filepath.Abs(cronicleFile)
+	if err != nil {
+		return nil, err
+	}
+	croniclePath := filepath.Dir(cronicleFileAbs)
+	r, err := git.PlainOpenWithOptions(croniclePath, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, err
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(wt.Filesystem.Root(), cronicleFileAbs)
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := r.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", revision, err)
+	}
+	commit, err := r.CommitObject(*h)
+	if err != nil {
+		return nil, err
+	}
+	file, err := commit.File(filepath.ToSlash(rel))
+	if err != nil {
+		return nil, fmt.Errorf("%s at %s: %w", rel, shortHash(h.String()), err)
+	}
+	src, err := file.Contents()
+	if err != nil {
+		return nil, err
+	}
+
+	parser := hclparse.NewParser()
+	f, diags := parser.ParseHCL([]byte(src), rel)
+	if !diags.HasErrors() {
+		var conf Config
+		diags = append(diags, gohcl.DecodeBody(f.Body, evalContext(f.Body), &conf)...)
+		if !diags.HasErrors() {
+			conf.PropigateTaskProperties(croniclePath)
+			return &conf, nil
+		}
+	}
+	wr := hcl.NewDiagnosticTextWriter(os.Stderr, parser.Files(), 78, true)
+	wr.WriteDiagnostics(diags)
+	return nil, fmt.Errorf("%s at %s: %w", rel, shortHash(h.String()), diags)
+}
+
+//PrintConfigDiff writes the schedule and task differences of the cronicle.hcl
+//between two revisions of its repo to w as text or as json.
+func PrintConfigDiff(w io.Writer, cronicleFile string, a string, b string, format string) error {
+	confA, err := ConfigAt(cronicleFile, a)
+	if err != nil {
+		return err
+	}
+	confB, err := ConfigAt(cronicleFile, b)
+	if err != nil {
+		return err
+	}
+	changes := DiffConfigs(confA, confB)
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(changes)
+	case "text", "":
+		if len(changes) == 0 {
+			fmt.Fprintln(w, "no schedule changes")
+		}
+		for _, s := range changes {
+			fmt.Fprintf(w, "schedule %q %s\n", s.Schedule, s.Change)
+			for _, f := range s.Fields {
+				fmt.Fprintf(w, "  %s: %s -> %s\n", f.Field, f.Old, f.New)
+			}
+			for _, t := range s.Tasks {
+				fmt.Fprintf(w, "  task %q %s\n", t.Task, t.Change)
+				for _, f := range t.Fields {
+					fmt.Fprintf(w, "    %s: %s -> %s\n", f.Field, f.Old, f.New)
+				}
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q, options are text and json", format)
+	}
+}
@@ -0,0 +1,185 @@
+package cronicle_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	cron "github.com/robfig/cron/v3"
+)
+
+var _ = Describe("Audit", func() {
+	var auditPath string
+	var cronicleFile string
+
+	hclA := `schedule "foo" {
+  cron = "@every 1h"
+  task "bar" {
+    command = ["/bin/echo", "bar"]
+  }
+  task "baz" {
+    command = ["/bin/echo", "baz"]
+  }
+}
+schedule "old" {
+  cron = "@every 1h"
+  task "bar" {
+    command = ["/bin/echo", "bar"]
+  }
+}
+`
+	hclB := `schedule "foo" {
+  cron = "@every 2h"
+  task "bar" {
+    command = ["/bin/echo", "bar", "${date}"]
+  }
+  task "qux" {
+    command = ["/bin/echo", "qux"]
+  }
+}
+schedule "new" {
+  cron = "@every 1h"
+  task "bar" {
+    command = ["/bin/echo", "bar"]
+  }
+}
+`
+
+	BeforeEach(func() {
+		auditPath, _ = filepath.Abs("./test_audit/")
+		os.MkdirAll(auditPath, 0777)
+		cronicleFile = filepath.Join(auditPath, "cronicle.hcl")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(auditPath)
+	})
+
+	It("cronicle.DiffConfigs should list the added, removed and changed schedules, tasks and properties", func() {
+		Expect(ioutil.WriteFile(cronicleFile, []byte(hclA), 0644)).To(BeNil())
+		confA, err := cronicle.GetConfig(cronicleFile)
+		Expect(err).To(BeNil())
+		Expect(ioutil.WriteFile(cronicleFile, []byte(hclB), 0644)).To(BeNil())
+		confB, err := cronicle.GetConfig(cronicleFile)
+		Expect(err).To(BeNil())
+
+		changes := cronicle.DiffConfigs(confA, confB)
+		Expect(changes).To(Equal([]cronicle.ScheduleChange{
+			{
+				Schedule: "foo",
+				Change:   cronicle.ChangeChanged,
+				Fields:   []cronicle.FieldChange{{Field: "Cron", Old: `"@every 1h"`, New: `"@every 2h"`}},
+				Tasks: []cronicle.TaskChange{
+					{Task: "bar", Change: cronicle.ChangeChanged, Fields: []cronicle.FieldChange{{Field: "Command", Old: `["/bin/echo","bar"]`, New: `["/bin/echo","bar","${date}"]`}}},
+					{Task: "qux", Change: cronicle.ChangeAdded},
+					{Task: "baz", Change: cronicle.ChangeRemoved},
+				},
+			},
+			{Schedule: "new", Change: cronicle.ChangeAdded},
+			{Schedule: "old", Change: cronicle.ChangeRemoved},
+		}))
+		Expect(cronicle.DiffConfigs(confB, confB)).To(BeEmpty())
+	})
+
+	It("cronicle.DiffConfigs should redact notify passwords", func() {
+		confA := cronicle.Default()
+		confB := cronicle.Default()
+		confB.Schedules[0].Notify = &cronicle.Notify{OnFailure: []cronicle.Target{{Type: cronicle.TargetEmail, Password: "secret"}}}
+		b, _ := json.Marshal(cronicle.DiffConfigs(&confA, &confB))
+		Expect(string(b)).ToNot(ContainSubstring("secret"))
+		Expect(string(b)).To(ContainSubstring("Notify"))
+	})
+
+	It("LoadCron should record the changes of an accepted reload in the audit log and history", func() {
+		c := cron.New()
+		queue := make(chan []byte, 1)
+		Expect(ioutil.WriteFile(cronicleFile, []byte(hclA), 0644)).To(BeNil())
+		cronicle.LoadCron(cronicleFile, c, queue, true)
+		Expect(ioutil.WriteFile(cronicleFile, []byte(hclB), 0644)).To(BeNil())
+		cronicle.LoadCron(cronicleFile, c, queue, false)
+		cronicle.LoadCron(cronicleFile, c, queue, false)
+
+		records, err := cronicle.NewHistory(auditPath).Audits(0)
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(2))
+		Expect(len(records[0].Changes)).To(Equal(3))
+		Expect(records[0].Changes[0].Schedule).To(Equal("foo"))
+
+		f, err := os.Open(filepath.Join(auditPath, ".cronicle", "audit.log"))
+		Expect(err).To(BeNil())
+		defer f.Close()
+		lines := 0
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var rec cronicle.AuditRecord
+			Expect(json.Unmarshal(scanner.Bytes(), &rec)).To(BeNil())
+			lines++
+		}
+		Expect(lines).To(Equal(2))
+	})
+
+	It("LoadCron should audit the first reload after a restart against the last audited commit", func() {
+		r, err := git.PlainInit(auditPath, false)
+		Expect(err).To(BeNil())
+		w, _ := r.Worktree()
+		commit := func(hcl string) string {
+			Expect(ioutil.WriteFile(cronicleFile, []byte(hcl), 0644)).To(BeNil())
+			_, err = w.Add("cronicle.hcl")
+			Expect(err).To(BeNil())
+			h, err := w.Commit("update schedules", &git.CommitOptions{Author: &object.Signature{Name: "a", Email: "a@example.com", When: time.Now()}})
+			Expect(err).To(BeNil())
+			return h.String()
+		}
+		queue := make(chan []byte, 1)
+		a := commit(hclA)
+		cronicle.LoadCron(cronicleFile, cron.New(), queue, true)
+		//a restart loads the same config again into a new cron
+		cronicle.LoadCron(cronicleFile, cron.New(), queue, true)
+		b := commit(hclB)
+		cronicle.LoadCron(cronicleFile, cron.New(), queue, true)
+
+		records, err := cronicle.NewHistory(auditPath).Audits(0)
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(2))
+		Expect(records[0].OldCommit).To(Equal(a))
+		Expect(records[0].NewCommit).To(Equal(b))
+		Expect(records[0].Author).To(Equal("a@example.com"))
+		Expect(len(records[0].Changes)).To(Equal(3))
+	})
+
+	It("cronicle.PrintConfigDiff should diff the cronicle.hcl between two commits", func() {
+		r, err := git.PlainInit(auditPath, false)
+		Expect(err).To(BeNil())
+		w, _ := r.Worktree()
+		hashes := []string{}
+		for _, hcl := range []string{hclA, hclB} {
+			Expect(ioutil.WriteFile(cronicleFile, []byte(hcl), 0644)).To(BeNil())
+			_, err = w.Add("cronicle.hcl")
+			Expect(err).To(BeNil())
+			h, err := w.Commit("update schedules", &git.CommitOptions{Author: &object.Signature{Name: "a", Email: "a@example.com", When: time.Now()}})
+			Expect(err).To(BeNil())
+			hashes = append(hashes, h.String())
+		}
+
+		var buf bytes.Buffer
+		Expect(cronicle.PrintConfigDiff(&buf, cronicleFile, hashes[0], "HEAD", "text")).To(BeNil())
+		Expect(buf.String()).To(ContainSubstring(`schedule "foo" changed`))
+		Expect(buf.String()).To(ContainSubstring(`Cron: "@every 1h" -> "@every 2h"`))
+		Expect(buf.String()).To(ContainSubstring(`task "qux" added`))
+		Expect(buf.String()).To(ContainSubstring(`schedule "old" removed`))
+
+		buf.Reset()
+		Expect(cronicle.PrintConfigDiff(&buf, cronicleFile, "HEAD", "HEAD", "text")).To(BeNil())
+		Expect(buf.String()).To(Equal("no schedule changes\n"))
+		Expect(cronicle.PrintConfigDiff(&buf, cronicleFile, "nope", "HEAD", "text")).ToNot(BeNil())
+	})
+})
@@ -0,0 +1,163 @@
+package cronicle
+
+import (
+	"errors"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	log "github.com/sirupsen/logrus"
+)
+
+//maxAuthorCommits caps the number of commits listed in a failure notification
+const maxAuthorCommits = 50
+
+//CommitInfo is a commit listed in a failure notification
+type CommitInfo struct {
+	Hash    string
+	Author  string
+	Message string
+}
+
+//ErrNotAncestor is returned by CommitsSince if the commit is not an ancestor of the checked out
+//commit, i.e. after a force push or a branch switch
+var ErrNotAncestor = errors.New("commit is not an ancestor of the checked out commit")
+
+//CommitsSince lists the commits reachable from g.Commit back to, and excluding, the commit
+//with hash since, newest first. At most max commits are listed. ErrNotAncestor is returned
+//if since is not an ancestor of g.Commit.
+func (g *Git) CommitsSince(since string, max int) ([]CommitInfo, error) {
+	sinceCommit, err := g.Repository.CommitObject(plumbing.NewHash(since))
+	if err == plumbing.ErrObjectNotFound {
+		return nil, ErrNotAncestor
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := sinceCommit.IsAncestor(g.Commit); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrNotAncestor
+	}
+
+	iter, err := g.Repository.Log(&git.LogOptions{From: g.Commit.Hash})
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	commits := []CommitInfo{}
+	err = iter.ForEach(func(c *object.Commit) error {
+		if c.Hash.String() == since || len(commits) >= max {
+			return storer.ErrStop
+		}
+		commits = append(commits, commitInfo(c))
+		return nil
+	})
+	return commits, err
+}
+
+
+//lastSuccessCommit returns the commit of the last successful attempt of the task, as queued with
+//the schedule run by the producer, or from the run history at task.CroniclePath.
+func (task *Task) lastSuccessCommit() (string, error) {
+	if commit, ok := task.lastSuccess[task.Name]; ok {
+		return commit, nil
+	}
+	return lastSuccessCommit(task.CroniclePath, task.ScheduleName, task.Name)
+}
+
+//lastSuccessCommit returns the commit of the last successful attempt of the named task in the run history
+func lastSuccessCommit(croniclePath string, scheduleName string, taskName string) (string, error) {
+	if croniclePath == "" {
+		return "", nil
+	}
+	records, err := NewHistory(croniclePath).Query(HistoryFilter{
+		Schedule: scheduleName,
+		Task:     taskName,
+		Status:   StatusSuccess,
+		Limit:    1,
+	})
+	if err != nil || len(records) == 0 {
+		return "", err
+	}
+	return records[0].Commit, nil
+}
+
+//lastSuccessCommits returns the commit of the last successful attempt of each task with
+//notify.author, and of its for_each instances, from the run history at schedule.CroniclePath.
+//The commits are queued with the run because a worker does not keep the run history.
+//Instances of a for_each over upstream outputs are not known before the run.
+func (schedule *Schedule) lastSuccessCommits() map[string]string {
+	if schedule.CroniclePath == "" {
+		return nil
+	}
+	var commits map[string]string
+	for _, task := range schedule.Tasks {
+		if task.Notify == nil || !task.Notify.Author {
+			continue
+		}
+		names := []string{task.Name}
+		if !task.dynamicForEach() {
+			for _, value := range task.ForEach {
+				names = append(names, task.instance(value).Name)
+			}
+		}
+		for _, name := range names {
+			commit, err := lastSuccessCommit(schedule.CroniclePath, schedule.Name, name)
+			if err != nil {
+				log.WithFields(log.Fields{"schedule": schedule.Name, "task": name}).Error(err)
+				continue
+			}
+			if commit == "" {
+				continue
+			}
+			if commits == nil {
+				commits = map[string]string{}
+			}
+			commits[name] = commit
+		}
+	}
+	return commits
+}
+
+//newCommits returns the commit of the last successful run and the commits since then, if the
+//task is failing on a different commit. Nothing is returned if the task never succeeded.
+//If the last successful commit is not an ancestor of the checked out commit only the checked
+//out commit is listed, so that the authors of unrelated history are not notified.
+func (task *Task) newCommits() (string, []CommitInfo) {
+	if task.Git.Commit == nil || task.Git.Repository == nil {
+		return "", nil
+	}
+	lastSuccess, err := task.lastSuccessCommit()
+	if err != nil {
+		log.WithFields(log.Fields{"schedule": task.ScheduleName, "task": task.Name}).Error(err)
+		return "", nil
+	}
+	if lastSuccess == "" || lastSuccess == task.Git.Commit.Hash.String() {
+		return "", nil
+	}
+	commits, err := task.Git.CommitsSince(lastSuccess, maxAuthorCommits)
+	if err == ErrNotAncestor {
+		return lastSuccess, []CommitInfo{commitInfo(task.Git.Commit)}
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"schedule": task.ScheduleName, "task": task.Name}).Error(err)
+		return "", nil
+	}
+	return lastSuccess, commits
+}
+
+//authors returns the unique author emails of the commits
+func authors(commits []CommitInfo) []string {
+	emails := []string{}
+	seen := map[string]bool{}
+	for _, c := range commits {
+		if c.Author != "" && !seen[c.Author] {
+			seen[c.Author] = true
+			emails = append(emails, c.Author)
+		}
+	}
+	return emails
+}
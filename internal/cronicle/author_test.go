@@ -0,0 +1,166 @@
+package cronicle_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Author", func() {
+	var authorPath string
+	var srcPath string
+	var server *httptest.Server
+	var received []cronicle.Notification
+	var cronicleFile string
+
+	//commit writes file and commits it to the src repo as author
+	commit := func(file string, author string) {
+		r, err := git.PlainOpen(srcPath)
+		Expect(err).To(BeNil())
+		w, _ := r.Worktree()
+		Expect(ioutil.WriteFile(filepath.Join(srcPath, file), []byte(file), 0644)).To(BeNil())
+		_, err = w.Add(file)
+		Expect(err).To(BeNil())
+		_, err = w.Commit("add "+file, &git.CommitOptions{Author: &object.Signature{Name: author, Email: author, When: time.Now()}})
+		Expect(err).To(BeNil())
+	}
+
+	BeforeEach(func() {
+		authorPath, _ = filepath.Abs("./test_author/")
+		srcPath = filepath.Join(authorPath, "src")
+		os.MkdirAll(srcPath, 0777)
+		_, err := git.PlainInit(srcPath, false)
+		Expect(err).To(BeNil())
+		commit("good", "a@example.com")
+
+		received = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var n cronicle.Notification
+			json.NewDecoder(r.Body).Decode(&n)
+			received = append(received, n)
+		}))
+
+		hcl := fmt.Sprintf(`schedule "foo" {
+  cron = "@every 1h"
+  task "bar" {
+    command = ["/bin/bash", "-c", "test ! -f broken"]
+    repo {
+      url = %q
+    }
+    notify {
+      author = true
+      on_failure "webhook" {
+        url = %q
+      }
+    }
+  }
+}
+`, srcPath, server.URL)
+		cronicleFile = filepath.Join(authorPath, "cronicle.hcl")
+		Expect(ioutil.WriteFile(cronicleFile, []byte(hcl), 0644)).To(BeNil())
+	})
+
+	//head returns the commit hash of the src repo
+	head := func() string {
+		r, err := git.PlainOpen(srcPath)
+		Expect(err).To(BeNil())
+		ref, err := r.Head()
+		Expect(err).To(BeNil())
+		return ref.Hash().String()
+	}
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(authorPath)
+	})
+
+	It("task.Execute should list the commits and authors since the last successful run on failure", func() {
+		good := head()
+		cronicle.ExecTasks(cronicleFile, "bar", "foo", time.Now())
+		Expect(received).To(BeEmpty())
+
+		commit("broken", "b@example.com")
+		commit("other", "c@example.com")
+		cronicle.ExecTasks(cronicleFile, "bar", "foo", time.Now())
+
+		Expect(len(received)).To(Equal(1))
+		Expect(received[0].LastSuccessCommit).To(Equal(good))
+		Expect(len(received[0].Commits)).To(Equal(2))
+		Expect(received[0].Commits[0].Author).To(Equal("c@example.com"))
+		Expect(received[0].Commits[1].Author).To(Equal("b@example.com"))
+		Expect(received[0].Commits[1].Message).To(Equal("add broken"))
+		Expect(received[0].Authors).To(Equal([]string{"c@example.com", "b@example.com"}))
+	})
+
+	It("task.Execute should only list the checked out commit if the last success is not an ancestor", func() {
+		base := head()
+		commit("fixed", "a@example.com")
+		fixed := head()
+		cronicle.ExecTasks(cronicleFile, "bar", "foo", time.Now())
+
+		//force push the src repo back to base
+		r, err := git.PlainOpen(srcPath)
+		Expect(err).To(BeNil())
+		w, _ := r.Worktree()
+		Expect(w.Reset(&git.ResetOptions{Commit: plumbing.NewHash(base), Mode: git.HardReset})).To(BeNil())
+		commit("broken", "b@example.com")
+		cronicle.ExecTasks(cronicleFile, "bar", "foo", time.Now())
+
+		Expect(len(received)).To(Equal(1))
+		Expect(received[0].LastSuccessCommit).To(Equal(fixed))
+		Expect(len(received[0].Commits)).To(Equal(1))
+		Expect(received[0].Commits[0].Hash).To(Equal(head()))
+		Expect(received[0].Authors).To(Equal([]string{"b@example.com"}))
+	})
+
+	It("task.Execute should not list commits if the task fails again on the same commit", func() {
+		commit("broken", "b@example.com")
+		cronicle.ExecTasks(cronicleFile, "bar", "foo", time.Now())
+		cronicle.ExecTasks(cronicleFile, "bar", "foo", time.Now())
+
+		Expect(len(received)).To(Equal(2))
+		Expect(received[1].Commits).To(BeEmpty())
+	})
+
+	It("ConsumeSchedule should list the commits since the last success queued by the producer", func() {
+		good := head()
+		cronicle.ExecTasks(cronicleFile, "bar", "foo", time.Now())
+		commit("broken", "b@example.com")
+
+		conf, err := cronicle.GetConfig(cronicleFile)
+		Expect(err).To(BeNil())
+		schedule := conf.Schedules[0]
+		schedule.Now = time.Now()
+		env := cronicle.NewEnvelope(schedule)
+		Expect(env.LastSuccess).To(Equal(map[string]string{"bar": good}))
+
+		//the worker has no run history of its own
+		workerPath := filepath.Join(authorPath, "worker")
+		os.MkdirAll(workerPath, 0777)
+		var wg sync.WaitGroup
+		queue := make(chan []byte)
+		go cronicle.ConsumeSchedule(queue, workerPath, &wg)
+		queue <- env.JSON()
+		close(queue)
+		time.Sleep(100 * time.Millisecond)
+		wg.Wait()
+
+		Expect(len(received)).To(Equal(1))
+		Expect(received[0].LastSuccessCommit).To(Equal(good))
+		Expect(len(received[0].Commits)).To(Equal(1))
+		Expect(received[0].Commits[0].Author).To(Equal("b@example.com"))
+	})
+})
@@ -0,0 +1,177 @@
+package cronicle
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+)
+
+//BisectStep is the result of executing the task at a commit of the bisect range
+type BisectStep struct {
+	Commit     CommitInfo
+	Success    bool
+	ExitStatus int
+}
+
+//BisectResult holds the first bad commit found by Task.Bisect and the steps taken
+type BisectResult struct {
+	FirstBad CommitInfo
+	Steps    []BisectStep
+}
+
+//Bisect finds the first commit between the good and bad commits at which the task fails.
+//The task repo is cloned into a scratch dir and task.Command is executed at time t, with
+//the same ${date} substitutions, at successive midpoints of the first parent history
+//from good to bad. Retries are not attempted and no run history is recorded.
+func (task *Task) Bisect(good string, bad string, t time.Time) (BisectResult, error) {
+	var result BisectResult
+	var repo *Repo
+	switch {
+	case task.Repo != nil:
+		repo = task.Repo
+	case task.CronicleRepo != nil && task.Path == task.CroniclePath:
+		repo = task.CronicleRepo
+	default:
+		return result, fmt.Errorf("task %q has no repo to bisect", task.Name)
+	}
+
+	scratch, err := ioutil.TempDir("", "cronicle-bisect-")
+	if err != nil {
+		return result, err
+	}
+	defer os.RemoveAll(scratch)
+	auth, err := repo.Auth()
+	if err != nil {
+		return result, err
+	}
+	g, err := Clone(scratch, repo.URL, &auth)
+	if err != nil {
+		return result, err
+	}
+
+	commits, err := g.bisectRange(good, bad)
+	if err != nil {
+		return result, err
+	}
+
+	//Relative to commits, good is at -1 and bad is at len(commits)-1
+	bisectTask := *task
+	bisectTask.Path = scratch
+	bisectTask.CroniclePath = ""
+	bisectTask.Notify = nil
+	lo, hi := -1, len(commits)-1
+	for hi-lo > 1 {
+		mid := (lo + hi) / 2
+		c := commits[mid]
+		if err := g.checkoutClean(c.Hash); err != nil {
+			return result, err
+		}
+		log.WithFields(log.Fields{
+			"schedule":  task.ScheduleName,
+			"task":      task.Name,
+			"commit":    shortHash(c.Hash.String()),
+			"remaining": hi - lo - 1,
+		}).Info("Bisecting...")
+		res := bisectTask.Exec(t)
+		step := BisectStep{Commit: commitInfo(c), Success: res.Error == nil, ExitStatus: res.ExitStatus}
+		result.Steps = append(result.Steps, step)
+		if step.Success {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	result.FirstBad = commitInfo(commits[hi])
+	return result, nil
+}
+
+//bisectRange returns the first parent history after good up to and including bad, oldest first
+func (g *Git) bisectRange(good string, bad string) ([]*object.Commit, error) {
+	goodHash, err := g.Repository.ResolveRevision(plumbing.Revision(good))
+	if err != nil {
+		return nil, fmt.Errorf("good %s: %w", good, err)
+	}
+	badHash, err := g.Repository.ResolveRevision(plumbing.Revision(bad))
+	if err != nil {
+		return nil, fmt.Errorf("bad %s: %w", bad, err)
+	}
+
+	commits := []*object.Commit{}
+	c, err := g.Repository.CommitObject(*badHash)
+	if err != nil {
+		return nil, err
+	}
+	for c.Hash != *goodHash {
+		commits = append([]*object.Commit{c}, commits...)
+		if c.NumParents() == 0 {
+			return nil, fmt.Errorf("good %s is not a first parent ancestor of bad %s", good, bad)
+		}
+		if c, err = c.Parent(0); err != nil {
+			return nil, err
+		}
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("good and bad are the same commit %s", goodHash)
+	}
+	return commits, nil
+}
+
+//checkoutClean checks out the commit, discarding changes and untracked files of prior executions
+func (g *Git) checkoutClean(hash plumbing.Hash) error {
+	if err := g.Worktree.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return err
+	}
+	return g.Worktree.Checkout(&git.CheckoutOptions{Hash: hash, Force: true})
+}
+
+func commitInfo(c *object.Commit) CommitInfo {
+	return CommitInfo{
+		Hash:    c.Hash.String(),
+		Author:  c.Author.Email,
+		Message: strings.SplitN(strings.TrimSpace(c.Message), "\n", 2)[0],
+	}
+}
+
+//PrintBisect bisects the named task of the cronicleFile between the good and bad commits
+//at time t and writes the steps and the first bad commit to w.
+func PrintBisect(w io.Writer, cronicleFile string, scheduleName string, taskName string, good string, bad string, t time.Time) error {
+	cronicleFileAbs, err := filepath.Abs(cronicleFile)
+	if err != nil {
+		return err
+	}
+	conf, err := GetConfig(cronicleFileAbs)
+	if err != nil {
+		return err
+	}
+	schedule, ok := conf.ScheduleMap()[scheduleName]
+	if !ok {
+		return fmt.Errorf("schedule %q not found", scheduleName)
+	}
+	task, ok := schedule.TaskMap()[taskName]
+	if !ok {
+		return fmt.Errorf("task %q not found in schedule %q", taskName, scheduleName)
+	}
+
+	result, err := task.Bisect(good, bad, t)
+	if err != nil {
+		return err
+	}
+	for _, step := range result.Steps {
+		status := StatusSuccess
+		if !step.Success {
+			status = StatusFailed
+		}
+		fmt.Fprintf(w, "%s %-7s exit %d  %s %s\n", shortHash(step.Commit.Hash), status, step.ExitStatus, step.Commit.Author, step.Commit.Message)
+	}
+	fmt.Fprintf(w, "%s is the first bad commit\nAuthor: %s\n\n    %s\n", result.FirstBad.Hash, result.FirstBad.Author, result.FirstBad.Message)
+	return nil
+}
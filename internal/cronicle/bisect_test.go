@@ -0,0 +1,103 @@
+package cronicle_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Bisect", func() {
+	var bisectPath string
+	var srcPath string
+	var hashes []string
+	var task cronicle.Task
+	t, _ := time.Parse(time.RFC3339, "2020-11-01T22:08:41+00:00")
+
+	//commit writes file and commits it to the src repo
+	commit := func(file string) {
+		r, err := git.PlainOpen(srcPath)
+		Expect(err).To(BeNil())
+		w, _ := r.Worktree()
+		Expect(ioutil.WriteFile(filepath.Join(srcPath, file), []byte(file), 0644)).To(BeNil())
+		_, err = w.Add(file)
+		Expect(err).To(BeNil())
+		h, err := w.Commit("add "+file, &git.CommitOptions{Author: &object.Signature{Name: file, Email: file + "@example.com", When: time.Now()}})
+		Expect(err).To(BeNil())
+		hashes = append(hashes, h.String())
+	}
+
+	BeforeEach(func() {
+		bisectPath, _ = filepath.Abs("./test_bisect/")
+		srcPath = filepath.Join(bisectPath, "src")
+		os.MkdirAll(srcPath, 0777)
+		_, err := git.PlainInit(srcPath, false)
+		Expect(err).To(BeNil())
+		hashes = nil
+		for i := 0; i < 10; i++ {
+			if i == 6 {
+				commit("broken")
+			} else {
+				commit(fmt.Sprintf("file%d", i))
+			}
+		}
+
+		schedule := cronicle.Schedule{Name: "foo"}
+		schedule.Tasks = []cronicle.Task{{
+			Name:    "bar",
+			Command: []string{"/bin/bash", "-c", "test ${date} = 2020-11-01 && test ! -f broken"},
+			Repo:    &cronicle.Repo{URL: srcPath},
+		}}
+		schedule.PropigateTaskProperties(bisectPath)
+		task = schedule.Tasks[0]
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(bisectPath)
+	})
+
+	It("task.Bisect should find the first bad commit in log2 steps", func() {
+		result, err := task.Bisect(hashes[0], hashes[9], t)
+		Expect(err).To(BeNil())
+		Expect(result.FirstBad.Hash).To(Equal(hashes[6]))
+		Expect(result.FirstBad.Author).To(Equal("broken@example.com"))
+		Expect(len(result.Steps)).To(BeNumerically("<=", 4))
+	})
+
+	It("task.Bisect should execute the task at the given time", func() {
+		result, err := task.Bisect(hashes[0], hashes[9], t.AddDate(0, 0, 1))
+		Expect(err).To(BeNil())
+		Expect(result.FirstBad.Hash).To(Equal(hashes[1]))
+	})
+
+	It("task.Bisect should error if good is not an ancestor of bad", func() {
+		_, err := task.Bisect(hashes[9], hashes[0], t)
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("cronicle.PrintBisect should report the first bad commit of a task in cronicle.hcl", func() {
+		hcl := fmt.Sprintf(`schedule "foo" {
+  task "bar" {
+    command = ["/bin/bash", "-c", "test ! -f broken"]
+    repo {
+      url = "%s"
+    }
+  }
+}
+`, srcPath)
+		cronicleFile := filepath.Join(bisectPath, "cronicle.hcl")
+		Expect(ioutil.WriteFile(cronicleFile, []byte(hcl), 0644)).To(BeNil())
+		var buf bytes.Buffer
+		err := cronicle.PrintBisect(&buf, cronicleFile, "foo", "bar", hashes[2], "HEAD", t)
+		Expect(err).To(BeNil())
+		Expect(buf.String()).To(ContainSubstring(hashes[6] + " is the first bad commit"))
+	})
+})
@@ -0,0 +1,108 @@
+package cronicle
+
+import (
+	"time"
+
+	cron "github.com/robfig/cron/v3"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//CatchupNone skips any fire times missed while the scheduler was down
+	CatchupNone = "none"
+	//CatchupLatest queues only the most recent missed fire time
+	CatchupLatest = "latest"
+	//CatchupAll queues every missed fire time in order
+	CatchupAll = "all"
+)
+
+//maxCatchupRuns caps the number of missed fire times queued for a single schedule
+const maxCatchupRuns = 1000
+
+//catchupWindow is the first window before now searched for missed fire times of a cron expression
+const catchupWindow = time.Hour
+
+//MissedRuns returns the fire times of schedule.Cron in loc that elapsed after last and up to now.
+//At most maxCatchupRuns of the most recent fire times are returned, the search starts near now
+//so a long downtime of a frequent schedule does not walk every elapsed fire time.
+func (schedule *Schedule) MissedRuns(last time.Time, now time.Time, loc *time.Location) ([]time.Time, error) {
+	sched, err := cron.ParseStandard(schedule.Cron)
+	if err != nil {
+		return nil, err
+	}
+
+	if last.IsZero() {
+		return []time.Time{}, nil
+	}
+	last = last.In(loc)
+
+	if every, ok := sched.(cron.ConstantDelaySchedule); ok {
+		//skip whole periods so the fire times keep the phase of last
+		if skip := now.Sub(last)/every.Delay - maxCatchupRuns; skip > 0 {
+			last = last.Add(skip * every.Delay)
+		}
+		return firesBetween(sched, last, now), nil
+	}
+
+	//cron expressions fire on wall clock times, so search a window before now
+	//and double it until it holds maxCatchupRuns fire times or reaches last
+	for window := catchupWindow; ; window *= 2 {
+		from := now.Add(-window)
+		if !from.After(last) {
+			return firesBetween(sched, last, now), nil
+		}
+		if missed := firesBetween(sched, from, now); len(missed) == maxCatchupRuns {
+			return missed, nil
+		}
+	}
+}
+
+//firesBetween returns the last maxCatchupRuns fire times of sched after from and up to now.
+func firesBetween(sched cron.Schedule, from time.Time, now time.Time) []time.Time {
+	missed := []time.Time{}
+	for next := sched.Next(from); !next.IsZero() && !next.After(now); next = sched.Next(next) {
+		missed = append(missed, next)
+		if len(missed) > maxCatchupRuns {
+			missed = missed[1:]
+		}
+	}
+	return missed
+}
+
+//CatchUp queues the fire times of schedule that were missed since the last fire time
+//recorded in the run history, according to schedule.Catchup.
+func CatchUp(schedule Schedule, queue chan<- []byte, now time.Time, loc *time.Location) {
+	switch schedule.Catchup {
+	case CatchupLatest, CatchupAll:
+	default:
+		return
+	}
+
+	last, err := NewHistory(schedule.CroniclePath).LastFire(schedule.Name)
+	if err != nil {
+		log.WithFields(log.Fields{"schedule": schedule.Name}).Error(err)
+		return
+	}
+
+	missed, err := schedule.MissedRuns(last, now, loc)
+	if err != nil {
+		log.WithFields(log.Fields{"schedule": schedule.Name, "cron": schedule.Cron}).Error(err)
+		return
+	}
+	if len(missed) == 0 {
+		return
+	}
+	if schedule.Catchup == CatchupLatest {
+		missed = missed[len(missed)-1:]
+	}
+
+	log.WithFields(log.Fields{
+		"schedule": schedule.Name,
+		"catchup":  schedule.Catchup,
+		"last":     last.Format(time.RFC3339),
+		"missed":   len(missed),
+	}).Info("Catching up missed runs...")
+	for _, t := range missed {
+		ProduceScheduleAt(schedule, queue, t)
+	}
+}
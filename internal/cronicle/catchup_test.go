@@ -0,0 +1,124 @@
+package cronicle_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Catchup", func() {
+	var catchupPath string
+	var schedule cronicle.Schedule
+	last, _ := time.Parse(time.RFC3339, "2020-11-01T00:30:00Z")
+	now, _ := time.Parse(time.RFC3339, "2020-11-01T03:10:00Z")
+
+	BeforeEach(func() {
+		catchupPath, _ = filepath.Abs("./test_catchup/")
+		schedule = cronicle.Default().Schedules[0]
+		schedule.Cron = "@hourly"
+		schedule.Timezone = "UTC"
+		schedule.PropigateTaskProperties(catchupPath)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(catchupPath)
+	})
+
+	queued := func(queue chan []byte) []time.Time {
+		close(queue)
+		times := []time.Time{}
+		for b := range queue {
+			_, s, err := cronicle.DecodeEnvelope(b)
+			Expect(err).To(BeNil())
+			times = append(times, s.Now)
+		}
+		return times
+	}
+
+	It("schedule.MissedRuns should return every fire time after last up to now", func() {
+		missed, err := schedule.MissedRuns(last, now, time.UTC)
+		Expect(err).To(BeNil())
+		Expect(len(missed)).To(Equal(3))
+		Expect(missed[0].Format(time.RFC3339)).To(Equal("2020-11-01T01:00:00Z"))
+		Expect(missed[2].Format(time.RFC3339)).To(Equal("2020-11-01T03:00:00Z"))
+	})
+
+	It("schedule.MissedRuns should return the most recent fire times of an @every schedule down a week", func() {
+		schedule.Cron = "@every 1s"
+		missed, err := schedule.MissedRuns(last.Add(-7*24*time.Hour), now, time.UTC)
+		Expect(err).To(BeNil())
+		Expect(len(missed)).To(Equal(1000))
+		Expect(missed[999].Equal(now)).To(BeTrue())
+		Expect(missed[0].Equal(now.Add(-999 * time.Second))).To(BeTrue())
+	})
+
+	It("schedule.MissedRuns should return the most recent fire times of a cron expression down a year", func() {
+		schedule.Cron = "*/5 * * * *"
+		missed, err := schedule.MissedRuns(last.AddDate(-1, 0, 0), now, time.UTC)
+		Expect(err).To(BeNil())
+		Expect(len(missed)).To(Equal(1000))
+		Expect(missed[999].Equal(now)).To(BeTrue())
+		Expect(missed[0].Equal(now.Add(-999 * 5 * time.Minute))).To(BeTrue())
+	})
+
+	It("schedule.MissedRuns should return nothing if the schedule has never fired", func() {
+		missed, err := schedule.MissedRuns(time.Time{}, now, time.UTC)
+		Expect(err).To(BeNil())
+		Expect(missed).To(BeEmpty())
+	})
+
+	It("cronicle.ProduceScheduleAt should queue schedule.Now and record the last fire time", func() {
+		queue := make(chan []byte, 1)
+		cronicle.ProduceScheduleAt(schedule, queue, last)
+		times := queued(queue)
+		Expect(len(times)).To(Equal(1))
+		Expect(times[0].Equal(last)).To(BeTrue())
+
+		lastFire, err := cronicle.NewHistory(catchupPath).LastFire(schedule.Name)
+		Expect(err).To(BeNil())
+		Expect(lastFire.Equal(last)).To(BeTrue())
+	})
+
+	It("cronicle.CatchUp should queue nothing for catchup = none", func() {
+		Expect(cronicle.NewHistory(catchupPath).SetLastFire(schedule.Name, last)).To(BeNil())
+		queue := make(chan []byte, 10)
+		cronicle.CatchUp(schedule, queue, now, time.UTC)
+		Expect(queued(queue)).To(BeEmpty())
+	})
+
+	It("cronicle.CatchUp should queue the latest missed run for catchup = latest", func() {
+		Expect(cronicle.NewHistory(catchupPath).SetLastFire(schedule.Name, last)).To(BeNil())
+		schedule.Catchup = cronicle.CatchupLatest
+		queue := make(chan []byte, 10)
+		cronicle.CatchUp(schedule, queue, now, time.UTC)
+		times := queued(queue)
+		Expect(len(times)).To(Equal(1))
+		Expect(times[0].Format(time.RFC3339)).To(Equal("2020-11-01T03:00:00Z"))
+	})
+
+	It("cronicle.CatchUp should queue every missed run in order for catchup = all", func() {
+		Expect(cronicle.NewHistory(catchupPath).SetLastFire(schedule.Name, last)).To(BeNil())
+		schedule.Catchup = cronicle.CatchupAll
+		queue := make(chan []byte, 10)
+		cronicle.CatchUp(schedule, queue, now, time.UTC)
+		times := queued(queue)
+		Expect(len(times)).To(Equal(3))
+		Expect(times[0].Format(time.RFC3339)).To(Equal("2020-11-01T01:00:00Z"))
+		Expect(times[1].Format(time.RFC3339)).To(Equal("2020-11-01T02:00:00Z"))
+		Expect(times[2].Format(time.RFC3339)).To(Equal("2020-11-01T03:00:00Z"))
+
+		lastFire, _ := cronicle.NewHistory(catchupPath).LastFire(schedule.Name)
+		Expect(lastFire.Format(time.RFC3339)).To(Equal("2020-11-01T03:00:00Z"))
+	})
+
+	It("conf.Validate() should error on an unknown catchup policy", func() {
+		conf := cronicle.Default()
+		conf.Schedules[0].Catchup = "sometimes"
+		err := conf.Validate()
+		Expect(err).ToNot(BeNil())
+	})
+})
@@ -0,0 +1,227 @@
+package cronicle
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//ConcurrencyAllow lets runs of a schedule overlap [default]
+	ConcurrencyAllow = "allow"
+	//ConcurrencyForbid skips a run of a schedule while the prior run is still executing
+	ConcurrencyForbid = "forbid"
+	//ConcurrencyReplace cancels the running instance of a schedule and starts the new run
+	ConcurrencyReplace = "replace"
+)
+
+var (
+	//ErrScheduleRunning is thrown because a schedule with concurrency = "forbid" is still running
+	ErrScheduleRunning = errors.New("schedule is already running")
+	//ErrScheduleReplaced is thrown because a running schedule was replaced by a newer run
+	ErrScheduleReplaced = errors.New("schedule run was replaced by a newer run")
+)
+
+//scheduleLocker coordinates overlapping schedule runs consumed by this process,
+//Run and StartWorker replace it with a RedisLocker in distributed redis mode.
+var scheduleLocker Locker = NewLocalLocker()
+
+//Locker coordinates the runs of a schedule for the schedule.Concurrency policy.
+type Locker interface {
+	//Acquire claims the run lock for the named schedule. If the lock is held and
+	//replace is true, the holder is cancelled and Acquire waits for it to release.
+	//The returned context is cancelled if the run is replaced by another Acquire,
+	//release must be called once the run is complete. ErrScheduleRunning is returned
+	//if the lock is held and replace is false.
+	Acquire(ctx context.Context, name string, replace bool) (context.Context, func(), error)
+}
+
+//ExecuteWithPolicy executes the schedule tasks according to schedule.Concurrency,
+//runs that overlap a running instance of the schedule are skipped or replace it.
+func (schedule Schedule) ExecuteWithPolicy(locker Locker) {
+	schedule.ExecuteWithPolicyContext(context.Background(), locker)
+}
+
+//ExecuteWithPolicyContext is ExecuteWithPolicy with a context, once ctx is done
+//running tasks are killed and tasks that have not started are not executed.
+func (schedule Schedule) ExecuteWithPolicyContext(ctx context.Context, locker Locker) {
+	switch schedule.Concurrency {
+	case ConcurrencyForbid, ConcurrencyReplace:
+	default:
+		schedule.ExecuteTasksContext(ctx)
+		return
+	}
+
+	start := time.Now()
+	replace := schedule.Concurrency == ConcurrencyReplace
+	ctx, release, err := locker.Acquire(ctx, schedule.Name, replace)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"schedule":    schedule.Name,
+			"concurrency": schedule.Concurrency,
+		}).Warn("Skip execution. ", err)
+		schedule.RecordStatus(start, StatusSkipped, err)
+		return
+	}
+	defer release()
+
+	schedule.ExecuteTasksContext(ctx)
+}
+
+type localLease struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+//LocalLocker is an in process Locker for single process and per worker enforcement.
+type LocalLocker struct {
+	mu     sync.Mutex
+	leases map[string]*localLease
+}
+
+//NewLocalLocker returns an empty LocalLocker
+func NewLocalLocker() *LocalLocker {
+	return &LocalLocker{leases: map[string]*localLease{}}
+}
+
+//Acquire claims the in process run lock for the named schedule
+func (l *LocalLocker) Acquire(ctx context.Context, name string, replace bool) (context.Context, func(), error) {
+	for {
+		l.mu.Lock()
+		held, ok := l.leases[name]
+		if !ok {
+			runCtx, cancel := context.WithCancel(ctx)
+			lease := &localLease{cancel: cancel, done: make(chan struct{})}
+			l.leases[name] = lease
+			l.mu.Unlock()
+			release := func() {
+				l.mu.Lock()
+				if l.leases[name] == lease {
+					delete(l.leases, name)
+				}
+				l.mu.Unlock()
+				cancel()
+				close(lease.done)
+			}
+			return runCtx, release, nil
+		}
+		l.mu.Unlock()
+
+		if !replace {
+			return nil, nil, ErrScheduleRunning
+		}
+		held.cancel()
+		select {
+		case <-held.done:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+//RedisLocker is a Locker that holds run leases in redis so that the concurrency
+//policy is enforced across distributed workers. A lease expires after ttl unless it
+//is refreshed by the worker holding it, so the lock of a dead worker is released.
+type RedisLocker struct {
+	client *redis.Client
+	ttl    time.Duration
+	prefix string
+}
+
+//NewRedisLocker returns a RedisLocker for the given client.
+func NewRedisLocker(client *redis.Client) *RedisLocker {
+	return &RedisLocker{client: client, ttl: 30 * time.Second, prefix: "cronicle:lock:"}
+}
+
+//refreshScript extends the lease if it is still held by the token in ARGV[1]
+var refreshScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+//releaseScript deletes the lease if it is still held by the token in ARGV[1]
+var releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+//Acquire claims the redis run lease for the named schedule. A replacing worker
+//requests cancellation through the name:replace key and waits for the lease.
+func (l *RedisLocker) Acquire(ctx context.Context, name string, replace bool) (context.Context, func(), error) {
+	key := l.prefix + name
+	replaceKey := key + ":replace"
+	token := newID()
+
+	ok, err := l.client.SetNX(key, token, l.ttl).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok && !replace {
+		return nil, nil, ErrScheduleRunning
+	}
+	if !ok {
+		if err := l.client.Set(replaceKey, token, l.ttl).Err(); err != nil {
+			return nil, nil, err
+		}
+		timeout := time.After(2 * l.ttl)
+		for !ok {
+			select {
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			case <-timeout:
+				return nil, nil, ErrScheduleRunning
+			case <-time.After(250 * time.Millisecond):
+			}
+			ok, err = l.client.SetNX(key, token, l.ttl).Result()
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		releaseScript.Run(l.client, []string{replaceKey}, token)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if n, _ := l.client.Exists(replaceKey).Result(); n > 0 {
+					log.WithFields(log.Fields{"schedule": name}).Warn(ErrScheduleReplaced)
+					cancel()
+				}
+				if held, err := refreshScript.Run(l.client, []string{key}, token, l.ttl.Milliseconds()).Int(); err != nil || held == 0 {
+					cancel()
+				}
+			}
+		}
+	}()
+
+	release := func() {
+		close(done)
+		cancel()
+		releaseScript.Run(l.client, []string{key}, token)
+	}
+	return runCtx, release, nil
+}
+
+//newID returns a random 128 bit hex id
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,146 @@
+package cronicle_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//signalLocker closes acquired once the first run acquired the lock
+type signalLocker struct {
+	cronicle.Locker
+	once     sync.Once
+	acquired chan struct{}
+}
+
+func (l *signalLocker) Acquire(ctx context.Context, name string, replace bool) (context.Context, func(), error) {
+	ctx, release, err := l.Locker.Acquire(ctx, name, replace)
+	if err == nil {
+		l.once.Do(func() { close(l.acquired) })
+	}
+	return ctx, release, err
+}
+
+var _ = Describe("Concurrency", func() {
+	var concurrencyPath string
+	var schedule cronicle.Schedule
+
+	//run returns a copy of the schedule with its own tasks, executing with command
+	run := func(command ...string) cronicle.Schedule {
+		s := schedule
+		s.Tasks = append([]cronicle.Task{}, schedule.Tasks...)
+		s.Tasks[0].Command = command
+		return s
+	}
+
+	BeforeEach(func() {
+		concurrencyPath, _ = filepath.Abs("./test_concurrency/")
+		os.MkdirAll(concurrencyPath, 0777)
+		schedule = cronicle.Default().Schedules[0]
+		schedule.Tasks[0].Command = []string{"/bin/sleep", "2"}
+		schedule.PropigateTaskProperties(concurrencyPath)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(concurrencyPath)
+	})
+
+	It("locker.Acquire should return ErrScheduleRunning while the lock is held", func() {
+		locker := cronicle.NewLocalLocker()
+		_, release, err := locker.Acquire(context.Background(), "foo", false)
+		Expect(err).To(BeNil())
+
+		_, _, err = locker.Acquire(context.Background(), "foo", false)
+		Expect(err).To(Equal(cronicle.ErrScheduleRunning))
+
+		release()
+		_, release, err = locker.Acquire(context.Background(), "foo", false)
+		Expect(err).To(BeNil())
+		release()
+	})
+
+	It("locker.Acquire with replace should cancel the holder and wait for it to release", func() {
+		locker := cronicle.NewLocalLocker()
+		ctx, release, err := locker.Acquire(context.Background(), "foo", false)
+		Expect(err).To(BeNil())
+		go func() {
+			<-ctx.Done()
+			release()
+		}()
+
+		_, replaced, err := locker.Acquire(context.Background(), "foo", true)
+		Expect(err).To(BeNil())
+		Expect(ctx.Err()).To(Equal(context.Canceled))
+		replaced()
+	})
+
+	It("schedule.ExecuteWithPolicy should skip an overlapping run for concurrency = forbid", func() {
+		schedule.Concurrency = cronicle.ConcurrencyForbid
+		locker := &signalLocker{Locker: cronicle.NewLocalLocker(), acquired: make(chan struct{})}
+		first := run("/bin/sleep", "1")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			first.ExecuteWithPolicy(locker)
+		}()
+		<-locker.acquired
+		run("/bin/sleep", "1").ExecuteWithPolicy(locker)
+		<-done
+
+		records, err := cronicle.NewHistory(concurrencyPath).Query(cronicle.HistoryFilter{Schedule: "foo"})
+		Expect(err).To(BeNil())
+		statuses := []string{}
+		for _, rec := range records {
+			if rec.Kind == cronicle.RunKindSchedule {
+				statuses = append(statuses, rec.Status)
+			}
+		}
+		Expect(statuses).To(Equal([]string{cronicle.StatusSuccess, cronicle.StatusSkipped}))
+	})
+
+	It("schedule.ExecuteWithPolicy should cancel the running instance for concurrency = replace", func() {
+		then := time.Now()
+		schedule.Concurrency = cronicle.ConcurrencyReplace
+		locker := cronicle.NewLocalLocker()
+		//the first task writes to the fifo once it is executing
+		fifo := filepath.Join(concurrencyPath, "started")
+		Expect(syscall.Mkfifo(fifo, 0666)).To(BeNil())
+		started := make(chan struct{})
+		go func() {
+			ioutil.ReadFile(fifo)
+			close(started)
+		}()
+		first := run("/bin/bash", "-c", "echo started > "+fifo+"; sleep 2")
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			first.ExecuteWithPolicy(locker)
+		}()
+		<-started
+		run("/bin/echo", "replaced").ExecuteWithPolicy(locker)
+		<-done
+		Expect(time.Since(then).Seconds()).To(BeNumerically("<", 2))
+
+		records, err := cronicle.NewHistory(concurrencyPath).Query(cronicle.HistoryFilter{Schedule: "foo", Task: "bar"})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(2))
+		Expect(records[0].Status).To(Equal(cronicle.StatusSuccess))
+		Expect(records[1].Status).To(Equal(cronicle.StatusFailed))
+		Expect(records[1].Error).To(Equal(context.Canceled.Error()))
+	})
+
+	It("conf.Validate() should error on an unknown concurrency policy", func() {
+		conf := cronicle.Default()
+		conf.Schedules[0].Concurrency = "sometimes"
+		err := conf.Validate()
+		Expect(err).ToNot(BeNil())
+	})
+})
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"strings"
 	"time"
+
+	cron "github.com/robfig/cron/v3"
 )
 
 // Config is the configuration structure for the cronicle checker.
@@ -21,9 +24,16 @@ type Config struct {
 	// Timezone Location to run cron in. i.e. "America/New_York" [IANA Time Zone database]
 	// https://en.wikipedia.org/wiki/List_of_tz_database_time_zones
 	Timezone string `hcl:"timezone,optional"`
+	// RunLogs is the default retention of per run task logs for all schedules
+	RunLogs *RunLogs `hcl:"run_logs,block"`
+	// Notify is the default notification targets of all tasks
+	Notify *Notify `hcl:"notify,block"`
 	// GitRemote *GitRemote `hcl:"git,block"`
 	Queue     *Queue     `hcl:"queue,block"`
 	Schedules []Schedule `hcl:"schedule,block"`
+
+	// Commit is the commit of the config repo the config was loaded from, if any
+	Commit string
 }
 
 // Schedule is the configuration structure that defines a cron job consisting of tasks.
@@ -38,14 +48,43 @@ type Schedule struct {
 	Timezone  string `hcl:"timezone,optional"`
 	StartDate string `hcl:"start_date,optional"`
 	EndDate   string `hcl:"end_date,optional"`
-	Repo      *Repo  `hcl:"repo,block"`
-	Tasks     []Task `hcl:"task,block"`
+	// Catchup is the policy for cron fire times missed while cronicle run was down.
+	// Options are "none" [default], "latest" and "all"
+	Catchup string `hcl:"catchup,optional"`
+	// Concurrency is the policy for a run that starts while the prior run is still executing.
+	// Options are "allow" [default], "forbid" (skip the new run) and "replace" (cancel the prior run)
+	Concurrency string `hcl:"concurrency,optional"`
+	// Timeout is the default task timeout for tasks in the schedule, i.e. "30m"
+	Timeout string `hcl:"timeout,optional"`
+	// RunLogs is the retention of per run task logs, overrides the config level run_logs
+	RunLogs *RunLogs `hcl:"run_logs,block"`
+	// Notify is the notification targets of the schedule tasks, overrides the config level notify
+	Notify *Notify `hcl:"notify,block"`
+	// RunOn is the labels a worker must have to run the schedule, i.e. ["gpu", "us-east"].
+	// In distributed mode the schedule is routed to the queue of the labels.
+	RunOn []string `hcl:"run_on,optional"`
+	// Dispatch is the unit of work produced to the workers in distributed mode. Options are
+	// "schedule" [default] (one worker executes all tasks) and "task" (the scheduler walks
+	// the task graph and produces each ready task on its own)
+	Dispatch string `hcl:"dispatch,optional"`
+	Repo     *Repo  `hcl:"repo,block"`
+	Tasks    []Task `hcl:"task,block"`
 	//Now is the execution time of the given schedule that will be used to
 	//fill variable task command ${datetime}. The cron scheduler generally provides
 	//the value.
 	Now time.Time
+	//RunID identifies a run of the schedule, it is assigned when the schedule is queued.
+	RunID string
 	//repo given at the config level, will be overridden by repo given at schedule or task level.
 	CronicleRepo *Repo
+	//CroniclePath is the local root of the cronicle repo the schedule executes in.
+	CroniclePath string
+	//Commit is the commit of the config repo the schedule was loaded from, it is carried by the
+	//Envelope of each run rather than the schedule json so that a new commit alone is no change.
+	Commit string `json:"-"`
+
+	//executor executes the tasks of the run, tasks execute in process if nil
+	executor taskExecutor
 }
 
 // Task is the configuration structure that defines a task (i.e., a command)
@@ -53,14 +92,35 @@ type Task struct {
 	Name         string   `hcl:"name,label"`
 	Command      []string `hcl:"command,optional"`
 	Depends      []string `hcl:"depends,optional"`
+	TriggerRule  string   `hcl:"trigger_rule,optional"`
+	ForEach      []string `hcl:"for_each,optional"`
 	Repo         *Repo    `hcl:"repo,block"`
 	Retry        *Retry   `hcl:"retry,block"`
 	Env          []string `hcl:"env,optional"`
+	Timeout      string   `hcl:"timeout,optional"`
+	MaxOutput    int      `hcl:"max_output,optional"`
+	Notify       *Notify  `hcl:"notify,block"`
+	RunOn        []string `hcl:"run_on,optional"`
 	Path         string
 	CronicleRepo *Repo
 	CroniclePath string
 	Git          Git
 	ScheduleName string
+
+	//outputs are the key=value outputs written by the last successful attempt to $CRONICLE_OUTPUT
+	outputs map[string]string
+	//upstream are the outputs of the completed tasks of the schedule run, by task name
+	upstream map[string]map[string]string
+	//eachValue is the for_each value of a task instance
+	eachValue string
+	//checkout is shared by the for_each instances of a schedule run, which check out the repo once
+	checkout *sharedCheckout
+	//runID is the Schedule.RunID of the schedule run executing the task
+	runID string
+	//lastSuccess are the commits of the last successful attempts by task name, queued with the run
+	lastSuccess map[string]string
+	//executor is the executor of the schedule run executing the task
+	executor taskExecutor
 }
 
 // Repo is the structure that defines a git repository
@@ -95,6 +155,97 @@ type Queue struct {
 	Type string `hcl:"type,optional"`
 	//host:port of nsqd/nsqlookupd/redis queue service
 	Addr string `hcl:"addr,optional"`
+	//Delivery of schedule runs to workers, options are at_most_once [default] and at_least_once.
+	//at_least_once redelivers a claimed run that is not acked by its worker within visibility_timeout.
+	Delivery string `hcl:"delivery,optional"`
+	//VisibilityTimeout is the time a claimed run may go without a worker ack before it is redelivered [default: 5m].
+	//With at_most_once a dispatched task that no worker started within visibility_timeout is failed.
+	VisibilityTimeout string `hcl:"visibility_timeout,optional"`
+
+	//Username is the redis ACL user, redis 6+
+	Username string `hcl:"username,optional"`
+	//Password of the redis queue, at most one of password, password_file and password_env is given
+	Password string `hcl:"password,optional"`
+	//PasswordFile is the path to a file holding the redis password, i.e. a mounted secret
+	PasswordFile string `hcl:"password_file,optional"`
+	//PasswordEnv is the name of the environment variable holding the redis password
+	PasswordEnv string `hcl:"password_env,optional"`
+	//DB is the redis database to select [default: 0]
+	DB int `hcl:"db,optional"`
+	//TLS connects to redis over tls if given
+	TLS *QueueTLS `hcl:"tls,block"`
+
+	//PoolSize is the max connections of each redis client [default: 10 per CPU]
+	PoolSize int `hcl:"pool_size,optional"`
+	//MinIdleConns is the number of idle redis connections kept open
+	MinIdleConns int `hcl:"min_idle_conns,optional"`
+	//MaxRetries is the number of retries of a failed redis command [default: 0]
+	MaxRetries int `hcl:"max_retries,optional"`
+	//DialTimeout, ReadTimeout, WriteTimeout, PoolTimeout and IdleTimeout are durations, i.e. "5s"
+	DialTimeout  string `hcl:"dial_timeout,optional"`
+	ReadTimeout  string `hcl:"read_timeout,optional"`
+	WriteTimeout string `hcl:"write_timeout,optional"`
+	PoolTimeout  string `hcl:"pool_timeout,optional"`
+	IdleTimeout  string `hcl:"idle_timeout,optional"`
+}
+
+//QueueTLS is the tls configuration of the redis queue connection
+type QueueTLS struct {
+	//CAFile is the path to the PEM certificates of the CAs that sign the server certificate [default: system roots]
+	CAFile string `hcl:"ca_file,optional"`
+	//CertFile and KeyFile are the paths to the PEM client certificate and key for mutual tls
+	CertFile string `hcl:"cert_file,optional"`
+	KeyFile  string `hcl:"key_file,optional"`
+	//ServerName verifies the server certificate against a name other than the host of addr
+	ServerName string `hcl:"server_name,optional"`
+	//InsecureSkipVerify skips the verification of the server certificate, for testing only
+	InsecureSkipVerify bool `hcl:"insecure_skip_verify,optional"`
+}
+
+//redacted returns a copy of conf with the queue and notify passwords masked, to be printed
+func (conf *Config) redacted() *Config {
+	printed := *conf
+	printed.Queue = conf.Queue.redacted()
+	printed.Notify = conf.Notify.redacted()
+	printed.Schedules = make([]Schedule, len(conf.Schedules))
+	for i, schedule := range conf.Schedules {
+		schedule.Notify = schedule.Notify.redacted()
+		schedule.Tasks = append([]Task{}, schedule.Tasks...)
+		for j := range schedule.Tasks {
+			schedule.Tasks[j].Notify = schedule.Tasks[j].Notify.redacted()
+		}
+		printed.Schedules[i] = schedule
+	}
+	return &printed
+}
+
+//hasNotifyPassword reports whether a notify target of conf gives its password in cronicle.hcl
+func (conf *Config) hasNotifyPassword() bool {
+	if conf.Notify.hasPassword() {
+		return true
+	}
+	for _, schedule := range conf.Schedules {
+		if schedule.Notify.hasPassword() {
+			return true
+		}
+		for _, task := range schedule.Tasks {
+			if task.Notify.hasPassword() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//visibilityTimeout returns the parsed queue.VisibilityTimeout or DefaultVisibilityTimeout
+func (queue *Queue) visibilityTimeout() time.Duration {
+	if queue == nil {
+		return DefaultVisibilityTimeout
+	}
+	if d, err := time.ParseDuration(queue.VisibilityTimeout); err == nil {
+		return d
+	}
+	return DefaultVisibilityTimeout
 }
 
 var (
@@ -133,6 +284,12 @@ func (task *Task) Validate() error {
 		}
 	}
 
+	if task.Timeout != "" {
+		if _, err := time.ParseDuration(task.Timeout); err != nil {
+			return fmt.Errorf(`task "%s" {} timeout: %w`, task.Name, err)
+		}
+	}
+
 	return nil
 }
 
@@ -146,6 +303,38 @@ func (conf *Config) Validate() error {
 		}
 	}
 
+	if conf.Notify != nil {
+		if err := conf.Notify.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if conf.Queue != nil {
+		switch conf.Queue.Delivery {
+		case "", DeliveryAtMostOnce, DeliveryAtLeastOnce:
+		default:
+			return fmt.Errorf(`queue {} delivery = "%s" is not one of at_most_once or at_least_once`, conf.Queue.Delivery)
+		}
+		if conf.Queue.VisibilityTimeout != "" {
+			d, err := time.ParseDuration(conf.Queue.VisibilityTimeout)
+			if err != nil {
+				return fmt.Errorf(`queue {} visibility_timeout: %w`, err)
+			}
+			if d < MinVisibilityTimeout {
+				return fmt.Errorf(`queue {} visibility_timeout = "%s" must be at least %s`, conf.Queue.VisibilityTimeout, MinVisibilityTimeout)
+			}
+		}
+		if err := conf.Queue.validateRedis(); err != nil {
+			return fmt.Errorf(`queue {} %w`, err)
+		}
+	}
+
+	if conf.Heartbeat != "" {
+		if _, err := cron.ParseStandard(conf.Heartbeat); err != nil {
+			return fmt.Errorf(`heartbeat = "%s": %w`, conf.Heartbeat, err)
+		}
+	}
+
 	scheduleNameCount := make(map[string]int)
 	for _, schedule := range conf.Schedules {
 		if schedule.Timezone != "" {
@@ -158,10 +347,95 @@ func (conf *Config) Validate() error {
 			return ErrScheduleNameEmpty
 		}
 
+		if schedule.Cron != "" && schedule.Cron != "@once" {
+			if _, err := cron.ParseStandard(schedule.Cron); err != nil {
+				return fmt.Errorf(`schedule "%s" {} cron = "%s": %w`, schedule.Name, schedule.Cron, err)
+			}
+		}
+
+		if err := schedule.validateGraph(); err != nil {
+			return err
+		}
+
+		switch schedule.Catchup {
+		case "", CatchupNone, CatchupLatest, CatchupAll:
+		default:
+			return fmt.Errorf(`schedule "%s" {} catchup = "%s" is not one of none, latest or all`, schedule.Name, schedule.Catchup)
+		}
+
+		switch schedule.Dispatch {
+		case "", DispatchSchedule, DispatchTask:
+		default:
+			return fmt.Errorf(`schedule "%s" {} dispatch = "%s" is not one of schedule or task`, schedule.Name, schedule.Dispatch)
+		}
+
+		switch schedule.Concurrency {
+		case "", ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace:
+		default:
+			return fmt.Errorf(`schedule "%s" {} concurrency = "%s" is not one of allow, forbid or replace`, schedule.Name, schedule.Concurrency)
+		}
+
+		if schedule.Timeout != "" {
+			if _, err := time.ParseDuration(schedule.Timeout); err != nil {
+				return fmt.Errorf(`schedule "%s" {} timeout: %w`, schedule.Name, err)
+			}
+		}
+
+		if schedule.Notify != nil {
+			if err := schedule.Notify.Validate(); err != nil {
+				return fmt.Errorf(`schedule "%s" {} %w`, schedule.Name, err)
+			}
+		}
+
+		if err := validateLabels(schedule.RunOn); err != nil {
+			return fmt.Errorf(`schedule "%s" {} run_on: %w`, schedule.Name, err)
+		}
+
+		runLogs := schedule.RunLogs
+		if runLogs == nil {
+			runLogs = conf.RunLogs
+		}
+		if runLogs != nil {
+			if runLogs.Retention != "" {
+				if _, err := time.ParseDuration(runLogs.Retention); err != nil {
+					return fmt.Errorf(`schedule "%s" {} run_logs {} retention: %w`, schedule.Name, err)
+				}
+			}
+			if runLogs.MaxRuns < 0 {
+				return fmt.Errorf(`schedule "%s" {} run_logs {} max_runs = %v must not be negative`, schedule.Name, runLogs.MaxRuns)
+			}
+		}
+
 		for _, task := range schedule.Tasks {
 			if task.Name == "" {
 				return ErrTaskNameEmpty
 			}
+			if task.Timeout != "" {
+				if _, err := time.ParseDuration(task.Timeout); err != nil {
+					return fmt.Errorf(`task "%s" {} timeout: %w`, task.Name, err)
+				}
+			}
+			if task.ForEach == nil && strings.Contains(strings.Join(task.Command, " "), EachValueRef) {
+				return fmt.Errorf(`task "%s" {} command references ${each.value} but for_each is not given`, task.Name)
+			}
+			for _, name := range task.outputRefs() {
+				if !task.dependsOn(schedule.TaskMap(), name) {
+					return fmt.Errorf(`task "%s" {} command references the outputs of task "%s" but does not depend on it`, task.Name, name)
+				}
+			}
+			if task.Notify != nil {
+				if err := task.Notify.Validate(); err != nil {
+					return fmt.Errorf(`task "%s" {} %w`, task.Name, err)
+				}
+			}
+			if err := validateLabels(task.RunOn); err != nil {
+				return fmt.Errorf(`task "%s" {} run_on: %w`, task.Name, err)
+			}
+			switch task.TriggerRule {
+			case "", TriggerAllSuccess, TriggerAllDone, TriggerOneFailed, TriggerOneSuccess, TriggerNoneFailed:
+			default:
+				return fmt.Errorf(`task "%s" {} trigger_rule = "%s" is not one of all_success, all_done, one_failed, one_success or none_failed`, task.Name, task.TriggerRule)
+			}
 		}
 		scheduleNameCount[schedule.Name]++
 	}
@@ -181,6 +455,12 @@ func (conf *Config) PropigateTaskProperties(croniclePath string) {
 		if conf.Schedules[i].Timezone == "" {
 			conf.Schedules[i].Timezone = conf.Timezone
 		}
+		if conf.Schedules[i].RunLogs == nil {
+			conf.Schedules[i].RunLogs = conf.RunLogs
+		}
+		if conf.Schedules[i].Notify == nil {
+			conf.Schedules[i].Notify = conf.Notify
+		}
 		conf.Schedules[i].CronicleRepo = conf.Repo
 		conf.Schedules[i].PropigateTaskProperties(croniclePath)
 	}
@@ -189,6 +469,7 @@ func (conf *Config) PropigateTaskProperties(croniclePath string) {
 //PropigateTaskProperties pushes schedule.Name, schedule.Repo and the repo path down to the task values.
 //It also populates task.Git.ReferenceName with task.Branch or HEAD.
 func (schedule *Schedule) PropigateTaskProperties(croniclePath string) {
+	schedule.CroniclePath = croniclePath
 	// Assign the path for each task or schedule repo
 	for i, task := range schedule.Tasks {
 		// if task.Branch != "" {
@@ -250,6 +531,12 @@ func (schedule *Schedule) PropigateTaskProperties(croniclePath string) {
 		schedule.Tasks[i].CronicleRepo = schedule.CronicleRepo
 		schedule.Tasks[i].Repo = repo
 		schedule.Tasks[i].ScheduleName = schedule.Name
+		if task.Timeout == "" {
+			schedule.Tasks[i].Timeout = schedule.Timeout
+		}
+		if task.Notify == nil {
+			schedule.Tasks[i].Notify = schedule.Notify
+		}
 	}
 }
 
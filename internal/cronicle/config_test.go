@@ -71,6 +71,29 @@ var _ = Describe("Config", func() {
 
 	})
 
+	It("conf.Validate() should error on an invalid schedule cron or heartbeat", func() {
+		conf := cronicle.Default()
+		conf.Schedules[0].Cron = "@every nope"
+		Expect(conf.Validate()).ToNot(BeNil())
+
+		conf = cronicle.Default()
+		conf.Heartbeat = "* * *"
+		Expect(conf.Validate()).ToNot(BeNil())
+	})
+
+	It("conf.Validate() should error if a task depends on a missing task or the tasks form a cycle", func() {
+		conf := cronicle.Default()
+		conf.Schedules[0].Tasks[0].Depends = []string{"qux"}
+		Expect(conf.Validate()).To(MatchError(ContainSubstring(`depends on task "qux" which does not exist`)))
+
+		conf = cronicle.Default()
+		conf.Schedules[0].Tasks = []cronicle.Task{
+			{Name: "a", Depends: []string{"b"}},
+			{Name: "b", Depends: []string{"a"}},
+		}
+		Expect(conf.Validate()).To(MatchError(ContainSubstring("dependency cycle")))
+	})
+
 	It("conf.PropigateTaskProperties(./path/) should propigate config Location", func() {
 		conf := cronicle.Default()
 		conf.Timezone = "America/New_York"
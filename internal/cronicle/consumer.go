@@ -0,0 +1,186 @@
+package cronicle
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/matryer/vice"
+	log "github.com/sirupsen/logrus"
+)
+
+//DefaultDrainTimeout is the time a worker waits for its runs in flight to complete after SIGTERM
+const DefaultDrainTimeout = 5 * time.Minute
+
+//drainKillGrace is the time the runs that were cancelled at the drain timeout get to record their outcome
+const drainKillGrace = 10 * time.Second
+
+//redisPopTimeout bounds a blocking pop so that a redis worker notices that it was stopped
+const redisPopTimeout = time.Second
+
+//ScheduleSource returns the next queued message, it returns false once ctx is done or the queue is closed
+type ScheduleSource func(ctx context.Context) ([]byte, bool)
+
+//ChannelSource returns the messages of a channel, i.e. of a vice transport Receive
+func ChannelSource(queue <-chan []byte) ScheduleSource {
+	return func(ctx context.Context) ([]byte, bool) {
+		if ctx.Err() != nil {
+			return nil, false
+		}
+		select {
+		case b, ok := <-queue:
+			return b, ok
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+//redisSource pops the messages of the named redis lists, which the redis vice transport produces to.
+//A message is only popped when it is asked for so that a saturated worker leaves the queued
+//schedules to the other workers. A message popped once ctx is done is pushed back to its list.
+func redisSource(client *redis.Client, names []string) ScheduleSource {
+	return func(ctx context.Context) ([]byte, bool) {
+		for ctx.Err() == nil {
+			res, err := client.BRPop(redisPopTimeout, names...).Result()
+			switch {
+			case err == redis.Nil:
+			case err != nil:
+				log.WithFields(log.Fields{"cronicle": "worker"}).Error(err)
+				select {
+				case <-time.After(redisPopTimeout):
+				case <-ctx.Done():
+				}
+			case ctx.Err() != nil:
+				//the worker stopped while the pop was blocked, the vice transport pops the tail of the list
+				if err := client.RPush(res[0], res[1]).Err(); err != nil {
+					log.WithFields(log.Fields{"cronicle": "worker"}).Error(err)
+				}
+			default:
+				//res is the name of the list and the message
+				return []byte(res[1]), true
+			}
+		}
+		return nil, false
+	}
+}
+
+//workerSource returns the schedules a worker with runOptions.Labels consumes from the transport
+func workerSource(transport vice.Transport, runOptions RunOptions) (ScheduleSource, error) {
+	if runOptions.QueueType == "redis" {
+		client, err := newRedisClient(runOptions)
+		if err != nil {
+			return nil, err
+		}
+		return redisSource(client, LabelQueues(runOptions.QueueName, runOptions.Labels)), nil
+	}
+	return ChannelSource(receiveSchedules(transport, runOptions.QueueName, runOptions.Labels)), nil
+}
+
+//Consumer executes the schedules consumed from a queue with at most MaxConcurrent runs in flight,
+//a saturated Consumer stops taking messages from the source until a run completes. The messages
+//a vice transport already received, i.e. from nsq, are held by the worker meanwhile.
+type Consumer struct {
+	//Path is the cronicle path the schedules execute in
+	Path string
+	//MaxConcurrent bounds the runs in flight, 0 is unbounded
+	MaxConcurrent int
+
+	slots chan struct{}
+	runs  sync.WaitGroup
+	//stopped is closed once Consume returned, no run is started after it
+	stopped chan struct{}
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+//NewConsumer returns a Consumer of the schedules that execute in path
+func NewConsumer(path string, maxConcurrent int) *Consumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Consumer{Path: path, MaxConcurrent: maxConcurrent, stopped: make(chan struct{}), ctx: ctx, cancel: cancel}
+	if maxConcurrent > 0 {
+		c.slots = make(chan struct{}, maxConcurrent)
+	}
+	return c
+}
+
+//Consume executes the schedules of source until ctx is done or the source is closed,
+//the runs in flight keep executing until they complete or Drain cancels them.
+//Consume is called once per Consumer.
+func (c *Consumer) Consume(ctx context.Context, source ScheduleSource) {
+	defer close(c.stopped)
+	for {
+		if c.slots != nil {
+			select {
+			case c.slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if ctx.Err() != nil {
+			c.release()
+			return
+		}
+		b, ok := source(ctx)
+		if !ok {
+			c.release()
+			return
+		}
+		c.runs.Add(1)
+		workerRunsInFlight.Inc()
+		go func() {
+			defer c.runs.Done()
+			defer workerRunsInFlight.Dec()
+			defer c.release()
+			consumeMessage(c.ctx, b, c.Path)
+		}()
+	}
+}
+
+func (c *Consumer) release() {
+	if c.slots != nil {
+		<-c.slots
+	}
+}
+
+//Drain waits for Consume to return once its ctx is done and up to timeout for the runs in flight
+//to complete, the runs still executing at the timeout are cancelled. Drain returns false if runs
+//had to be cancelled.
+func (c *Consumer) Drain(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		<-c.stopped
+		c.runs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+	}
+	log.WithFields(log.Fields{"cronicle": "worker", "timeout": timeout}).Warn("Drain timeout, cancelling the runs in flight")
+	c.cancel()
+	select {
+	case <-done:
+	case <-time.After(drainKillGrace):
+	}
+	return false
+}
+
+//stopWorker drains the runs in flight of the consumer, the worker heartbeat reports that
+//the worker is draining and, once the runs completed or were cancelled, that it stopped.
+func stopWorker(consumer *Consumer, timeout time.Duration, path string) {
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+	log.WithFields(log.Fields{"cronicle": "worker", "timeout": timeout}).Info("Stopped consuming, draining the runs in flight...")
+	status := localWorker.setState(true, false, time.Now())
+	report(RunResult{CroniclePath: path, Worker: &status})
+
+	if consumer.Drain(timeout) {
+		log.WithFields(log.Fields{"cronicle": "worker"}).Info("Drained")
+	}
+	status = localWorker.setState(true, true, time.Now())
+	report(RunResult{CroniclePath: path, Worker: &status})
+}
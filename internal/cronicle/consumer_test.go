@@ -0,0 +1,102 @@
+package cronicle_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Consumer", func() {
+	var consumerPath string
+
+	BeforeEach(func() {
+		consumerPath, _ = filepath.Abs("./test_consumer/")
+		os.MkdirAll(consumerPath, 0777)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(consumerPath)
+	})
+
+	envelope := func(runID string, command ...string) []byte {
+		schedule := cronicle.Schedule{Name: "foo", Now: time.Now(), RunID: runID}
+		schedule.Tasks = []cronicle.Task{{Name: "bar", Command: command}}
+		return cronicle.NewEnvelope(schedule).JSON()
+	}
+
+	It("Consume should not take a message from the queue while saturated", func() {
+		queue := make(chan []byte, 3)
+		queue <- envelope("consume-run1", "/bin/sleep", "0.3")
+		queue <- envelope("consume-run2", "/bin/sleep", "0.3")
+		queue <- envelope("consume-run3", "/bin/sleep", "0.3")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		c := cronicle.NewConsumer(consumerPath, 1)
+		go c.Consume(ctx, cronicle.ChannelSource(queue))
+		time.Sleep(100 * time.Millisecond)
+		Expect(len(queue)).To(Equal(2))
+
+		cancel()
+		Expect(c.Drain(time.Minute)).To(BeTrue())
+		Expect(len(queue)).To(Equal(2))
+		records, err := cronicle.NewHistory(consumerPath).Query(cronicle.HistoryFilter{Task: "bar"})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(1))
+		Expect(records[0].Status).To(Equal(cronicle.StatusSuccess))
+	})
+
+	It("Drain should wait for a message the source returned after the worker stopped", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		popped := make(chan struct{})
+		source := func(context.Context) ([]byte, bool) {
+			select {
+			case <-popped:
+				return nil, false
+			default:
+			}
+			//the pop was in flight when the worker stopped
+			cancel()
+			close(popped)
+			return envelope("late-run", "/bin/echo", "late"), true
+		}
+		c := cronicle.NewConsumer(consumerPath, 0)
+		go c.Consume(ctx, source)
+		<-popped
+
+		Expect(c.Drain(time.Minute)).To(BeTrue())
+		records, err := cronicle.NewHistory(consumerPath).Query(cronicle.HistoryFilter{Task: "bar"})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(1))
+	})
+
+	It("Drain should cancel the runs in flight at the timeout", func() {
+		queue := make(chan []byte, 1)
+		queue <- envelope("drain-run", "/bin/sleep", "10")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		c := cronicle.NewConsumer(consumerPath, 0)
+		go c.Consume(ctx, cronicle.ChannelSource(queue))
+		Eventually(func() int { return len(queue) }).Should(Equal(0))
+		cancel()
+
+		start := time.Now()
+		Expect(c.Drain(200 * time.Millisecond)).To(BeFalse())
+		Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		records, err := cronicle.NewHistory(consumerPath).Query(cronicle.HistoryFilter{Task: "bar"})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(1))
+		Expect(records[0].Status).ToNot(Equal(cronicle.StatusSuccess))
+	})
+
+	It("WorkerStatus.State should report draining and stopped workers", func() {
+		now := time.Now()
+		Expect(cronicle.WorkerStatus{LastSeen: now, Draining: true}.State(now)).To(Equal(cronicle.WorkerDraining))
+		Expect(cronicle.WorkerStatus{LastSeen: now, Draining: true, Stopped: true}.State(now)).To(Equal(cronicle.WorkerStopped))
+		Expect(cronicle.WorkerStatus{LastSeen: now.Add(-time.Hour), Draining: true}.State(now)).To(Equal(cronicle.WorkerDead))
+	})
+})
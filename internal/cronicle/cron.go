@@ -1,10 +1,13 @@
 package cronicle
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
 	"path"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -39,12 +42,16 @@ func Run(cronicleFile string, runOptions RunOptions) {
 	if err != nil {
 		log.Fatal(err)
 	}
-	confPriorGlobal = conf
-	hcl := conf.Hcl()
+	setConfPrior(conf)
+	hcl := conf.redacted().Hcl()
 	slantyedCyan := color.New(color.FgCyan, color.Italic).SprintFunc()
 	fmt.Printf("%s", slantyedCyan(string(hcl.Bytes)))
+	if conf.hasNotifyPassword() {
+		log.WithFields(log.Fields{"cronicle": "start"}).Warn("notify password is given in cronicle.hcl, use password_env to keep it out of the repo")
+	}
 
 	if runOptions.LogToFile {
+		logToFileGlobal = true
 		logPath := path.Join(croniclePath, path.Join(".cronicle", "log"))
 		logFile := path.Join(logPath, "cronicle.log")
 		log.SetOutput(&lumberjack.Logger{
@@ -56,30 +63,95 @@ func Run(cronicleFile string, runOptions RunOptions) {
 		})
 	}
 
-	if runOptions.QueueType == "" {
-		if conf.Queue != nil {
+	if conf.Queue != nil {
+		if runOptions.QueueType == "" {
 			runOptions.QueueType = conf.Queue.Type
 		}
+		if runOptions.Addr == "" {
+			runOptions.Addr = conf.Queue.Addr
+		}
+		runOptions.Queue = conf.Queue
+	}
+	//SIGTERM stops the scheduler and drains the runs in flight of the worker thread
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	var consumer *Consumer
+	var transport vice.Transport
+	if runOptions.API != "" {
+		go ServeAPI(runOptions.API, runOptions.APIToken)
+	}
+	if runOptions.Metrics != "" {
+		go ServeMetrics(runOptions.Metrics)
 	}
-	//TODO: WaitGroup is currently only used for testing, could be used in Producer
-	var wg sync.WaitGroup
-	wg.Add(1) //Ensure WaitGroup counter > 0
 	if runOptions.QueueType == "" {
+		if conf.Queue != nil && conf.Queue.Delivery == DeliveryAtLeastOnce {
+			log.WithFields(log.Fields{"cronicle": "start"}).Warn("queue delivery = at_least_once requires a queue type, runs are delivered at most once")
+		}
+		for _, schedule := range conf.Schedules {
+			if len(schedule.RunOnLabels()) > 0 {
+				log.WithFields(log.Fields{"cronicle": "start", "schedule": schedule.Name}).Warn("run_on requires a queue type, the schedule runs on this process")
+			}
+			if schedule.Dispatch == DispatchTask {
+				log.WithFields(log.Fields{"cronicle": "start", "schedule": schedule.Name}).Warn(`dispatch = "task" requires a queue type, the tasks run on this process`)
+			}
+		}
 		queue := make(chan []byte)
 		go StartCron(cronicleFileAbs, queue)
-		go ConsumeSchedule(queue, croniclePath, &wg)
+		go startHeartbeats(croniclePath, runOptions.Labels)
+		consumer = NewConsumer(croniclePath, runOptions.MaxConcurrent)
+		go consumer.Consume(ctx, ChannelSource(queue))
 	} else {
-		transport := MakeViceTransport(runOptions.QueueType, runOptions.Addr)
+		if runOptions.RunWorker {
+			if err := validateWorkerLabels(runOptions.Labels); err != nil {
+				log.Fatal(err)
+			}
+		}
+		transport, err = MakeViceTransport(runOptions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		queueRouter = NewRouter(runOptions.QueueName, transport.Send)
+		taskDispatcher = NewDispatcher(conf.Queue.visibilityTimeout())
+		if conf.Queue != nil && conf.Queue.Delivery == DeliveryAtLeastOnce {
+			deliveryGlobal = NewDelivery(conf.Queue.visibilityTimeout())
+			go deliveryGlobal.start()
+		} else {
+			//without redelivery the tasks of dead workers are failed by the dispatcher
+			go taskDispatcher.start()
+		}
+		deadLetterQueue = transport.Send(runOptions.QueueName + DeadLetterQueueSuffix)
+		go ConsumeResults(transport.Receive(runOptions.QueueName+ResultsQueueSuffix), LocalReporter{CroniclePath: croniclePath})
 		go StartCron(cronicleFileAbs, transport.Send(runOptions.QueueName))
 		if runOptions.RunWorker {
-			go ConsumeSchedule(transport.Receive(runOptions.QueueName), croniclePath, &wg)
+			if err := setScheduleLocker(runOptions); err != nil {
+				log.Fatal(err)
+			}
+			source, err := workerSource(transport, runOptions)
+			if err != nil {
+				log.Fatal(err)
+			}
+			go startHeartbeats(croniclePath, runOptions.Labels)
+			consumer = NewConsumer(croniclePath, runOptions.MaxConcurrent)
+			go consumer.Consume(ctx, source)
 		}
 	}
 
-	wg.Wait() //Wait forever
-
+	<-ctx.Done()
+	log.WithFields(log.Fields{"cronicle": "stop"}).Info("Stopping Scheduler...")
+	schedulerGlobal.stop()
+	if consumer != nil {
+		stopWorker(consumer, runOptions.DrainTimeout, croniclePath)
+	}
+	if transport != nil {
+		//flushes the queued results and schedules
+		transport.Stop()
+	}
 }
 
+//logToFileGlobal is set when the log is written to cronicle.log, which then leaves the
+//task output to the run logs
+var logToFileGlobal bool
+
 // RunOptions enables the runtime configuration of the distributed message queue
 type RunOptions struct {
 	RunWorker bool
@@ -87,10 +159,29 @@ type RunOptions struct {
 	QueueName string
 	Addr      string
 	LogToFile bool
+	//API is the host:port to serve the http api at, i.e. ":8080" on 127.0.0.1, the api is disabled if empty
+	API string
+	//APIToken is the bearer token the api requests must carry, the api is unauthenticated if empty
+	APIToken string
+	//Metrics is the host:port to serve prometheus metrics at /metrics, i.e. ":9090", disabled if empty
+	Metrics string
+	//Labels are reported in the worker heartbeat, i.e. ["gpu", "us-east"], the worker
+	//consumes the schedules with run_on labels that are a subset of its labels
+	Labels []string
+	//MaxConcurrent bounds the schedule runs the worker executes at once, 0 is unbounded.
+	//A saturated redis worker stops taking schedules from the queue until a run completes. The nsq
+	//consumer has already acked the messages it hands over, so a saturated nsq worker still takes
+	//up to two messages of each queue it consumes and holds them until a run completes.
+	MaxConcurrent int
+	//DrainTimeout is the time the worker waits for its runs in flight on SIGTERM before
+	//they are cancelled [default: DefaultDrainTimeout]
+	DrainTimeout time.Duration
+	//Queue is the queue block of cronicle.hcl, which holds the redis credentials, tls and pool options
+	Queue *Queue
 }
 
 // StartWorker listens to a vice transport queue for schedules
-// produced by cronicle run
+// produced by cronicle run until SIGTERM, then drains the runs in flight and returns
 func StartWorker(path string, runOptions RunOptions) {
 
 	pathAbs, err := filepath.Abs(path)
@@ -98,40 +189,66 @@ func StartWorker(path string, runOptions RunOptions) {
 		log.Fatal(err)
 	}
 
+	if runOptions.Queue == nil {
+		//the credentials of the queue are read from the cronicle.hcl at path, if there is one
+		if runOptions.Queue, err = loadQueue(pathAbs); err != nil {
+			log.Fatal(err)
+		}
+		if runOptions.Queue != nil && runOptions.Addr == "" {
+			runOptions.Addr = runOptions.Queue.Addr
+		}
+	}
 	if runOptions.QueueType == "" {
 		log.Error("--queue must be specified in distributed mode. [Options: redis, nsq]")
 	}
-	transport := MakeViceTransport(runOptions.QueueType, runOptions.Addr)
-	schedules := transport.Receive(runOptions.QueueName)
-	var wg sync.WaitGroup
-	wg.Add(1) //Ensure WaitGroup counter > 0
-	go ConsumeSchedule(schedules, pathAbs, &wg)
-
-	wg.Wait()
-
+	if err := validateWorkerLabels(runOptions.Labels); err != nil {
+		log.Fatal(err)
+	}
+	transport, err := MakeViceTransport(runOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := setScheduleLocker(runOptions); err != nil {
+		log.Fatal(err)
+	}
+	source, err := workerSource(transport, runOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	//history, metrics and notifications of the runs are reported to the cronicle run node
+	resultReporter = QueueReporter{Queue: transport.Send(runOptions.QueueName + ResultsQueueSuffix)}
+	deadLetterQueue = transport.Send(runOptions.QueueName + DeadLetterQueueSuffix)
+	if runOptions.Metrics != "" {
+		go ServeMetrics(runOptions.Metrics)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	go startHeartbeats(pathAbs, runOptions.Labels)
+	consumer := NewConsumer(pathAbs, runOptions.MaxConcurrent)
+	//the worker consumes the schedules without run_on labels and those routed to its labels
+	go consumer.Consume(ctx, source)
+
+	<-ctx.Done()
+	stopWorker(consumer, runOptions.DrainTimeout, pathAbs)
+	//flushes the reported results
+	transport.Stop()
 }
 
 //MakeViceTransport creates a vice.Transport interface from the given
 //queue field in the config
-func MakeViceTransport(queueType string, addr string) vice.Transport {
+func MakeViceTransport(runOptions RunOptions) (vice.Transport, error) {
 	// var transport *nsqvice.Transport
+	addr := runOptions.Addr
 
-	switch queueType {
+	switch runOptions.QueueType {
 	case "redis":
-		if addr == "" {
-			addr = "127.0.0.1:6379"
-		}
-		opts := &redis.Options{
-			Network:    "tcp",
-			Addr:       addr,
-			Password:   "",
-			DB:         0,
-			MaxRetries: 0,
+		client, err := newRedisClient(runOptions)
+		if err != nil {
+			return nil, err
 		}
-		client := redis.NewClient(opts)
 		opt := redisvice.WithClient(client)
 		transport := redisvice.New(opt)
-		return transport
+		return transport, nil
 	case "nsq":
 		transport := nsqvice.New()
 		transport.ConnectConsumer = func(consumer *nsq.Consumer) error {
@@ -141,12 +258,41 @@ func MakeViceTransport(queueType string, addr string) vice.Transport {
 			return consumer.ConnectToNSQLookupd(addr)
 
 		}
-		return transport
+		return transport, nil
 	}
 
 	// return transpor
-	return nsqvice.New()
+	return nsqvice.New(), nil
+
+}
+
+//newRedisClient returns a redis client for the redis queue at runOptions.Addr
+//with the credentials, tls and pool options of runOptions.Queue
+func newRedisClient(runOptions RunOptions) (*redis.Client, error) {
+	opts, err := runOptions.Queue.RedisOptions(runOptions.Addr)
+	if err != nil {
+		return nil, err
+	}
+	return redis.NewClient(opts), nil
+}
 
+//setScheduleLocker picks the Locker that enforces schedule.Concurrency and the RunClaimer that
+//detects duplicate deliveries for the given queue, redis holds run leases and claims shared by
+//all workers, other queues enforce the policy and deduplicate per process.
+func setScheduleLocker(runOptions RunOptions) error {
+	switch runOptions.QueueType {
+	case "redis":
+		client, err := newRedisClient(runOptions)
+		if err != nil {
+			return err
+		}
+		scheduleLocker = NewRedisLocker(client)
+		runClaimer = NewRedisClaimer(client)
+	case "":
+	default:
+		log.WithFields(log.Fields{"queue": runOptions.QueueType}).Warn("schedule concurrency policies are enforced per worker")
+	}
+	return nil
 }
 
 //StartCron pushes all schedules in the given config to the cron scheduler
@@ -173,6 +319,7 @@ func StartCron(cronicleFile string, queue chan<- []byte) {
 	}, loc: loc})
 	log.WithFields(log.Fields{"cronicle": "start"}).Info("Starting Scheduler...")
 
+	now := time.Now()
 	for _, schedule := range conf.Schedules {
 		switch {
 		case schedule.Cron == "@once":
@@ -182,10 +329,12 @@ func StartCron(cronicleFile string, queue chan<- []byte) {
 			log.WithFields(log.Fields{"schedule": schedule.Name, "cron": schedule.Cron}).Info("Skip execution. Use 'cronicle exec' to run.")
 		default:
 			log.WithFields(log.Fields{"schedule": schedule.Name, "cron": schedule.Cron}).Info("Starting cron...")
+			CatchUp(schedule, queue, now, loc)
 		}
 	}
 
 	c := cron.New(cron.WithLocation(loc))
+	schedulerGlobal.start(c, queue)
 	c.Start()
 	if conf.Heartbeat == "" {
 		conf.Heartbeat = "@every 30s"
@@ -194,55 +343,191 @@ func StartCron(cronicleFile string, queue chan<- []byte) {
 	LoadCron(cronicleFile, c, queue, true)
 }
 
-//confPrior stores a gloabal state of the previosly loaded config for diff checking
+//confPrior stores a gloabal state of the previosly loaded config for diff checking,
+//it is read by the results and consumer goroutines through confPrior
 var confPriorGlobal *Config
+var confPriorMu sync.RWMutex
+
+//confPrior returns the last-known-good config
+func confPrior() *Config {
+	confPriorMu.RLock()
+	defer confPriorMu.RUnlock()
+	return confPriorGlobal
+}
+
+//setConfPrior sets the last-known-good config
+func setConfPrior(conf *Config) {
+	confPriorMu.Lock()
+	defer confPriorMu.Unlock()
+	confPriorGlobal = conf
+}
+
+//configRejectedGlobal holds the error of the last rejected config reload so that
+//a config that keeps failing on each heartbeat is only notified once
+var configRejectedGlobal string
 
 //LoadCron exeutes GetConfig(cronicleFile) to load the current config from file,
 //checks the given config against the global confPrior, and if there is a change,
-//stops the cron, removes all of the confPrior cron entries and adds the new conf
-//schedules to the cron.
+//diffs the schedules against the loaded schedules and only removes, adds or replaces
+//the cron entries of schedules that were removed, added or changed. The cron entries
+//of unchanged schedules are kept so that their timers are not reset. The changes of an
+//accepted reload are recorded in the audit log.
+//The reload is transactional, if the new config fails to parse or validate
+//the cron keeps running the confPrior schedules and the rejection is logged,
+//counted in the metrics and notified to the confPrior notify on_failure targets.
 func LoadCron(cronicleFile string, c *cron.Cron, queue chan<- []byte, force bool) {
 
 	log.WithFields(log.Fields{"cronicle": "heartbeat", "path": cronicleFile}).Info("Loading config...")
 	conf, err := GetConfig(cronicleFile)
 	if err != nil {
-		log.Error(err)
+		rejectConfig(cronicleFile, err)
+		return
 	}
 
-	if string(confPriorGlobal.Hcl().Bytes) != string(conf.Hcl().Bytes) || force {
-		log.WithFields(log.Fields{"cronicle": "heartbeat", "path": cronicleFile}).Info("Refreshing config...")
-		c.Stop()
-		for _, entry := range c.Entries() {
-			// assumes that LoadCron has entry.ID == 1
-			if entry.ID > 1 {
-				c.Remove(entry.ID)
+	if !force && string(confPrior().Hcl().Bytes) == string(conf.Hcl().Bytes) {
+		heartbeatReloads.WithLabelValues("unchanged").Inc()
+		acceptConfig(conf)
+		return
+	}
 
-			}
+	//parse every cron spec before any loaded entry is removed
+	specs := map[string]cron.Schedule{}
+	for _, schedule := range conf.Schedules {
+		if schedule.Cron == "@once" || schedule.Cron == "" {
+			continue
 		}
+		spec, err := cron.ParseStandard(schedule.Cron)
+		if err != nil {
+			fmt.Printf("\x1b[31;1m%s\x1b[0m\n", fmt.Sprintf("schedule cron format error: %s", schedule.Name))
+			rejectConfig(cronicleFile, fmt.Errorf(`schedule "%s" {} cron = "%s": %w`, schedule.Name, schedule.Cron, err))
+			return
+		}
+		specs[schedule.Name] = spec
+	}
 
-		for _, schedule := range conf.Schedules {
-			switch {
-			case schedule.Cron == "@once":
-				log.WithFields(log.Fields{"schedule": schedule.Name, "cron": schedule.Cron}).Info("@once execution complete at 'cronicle run'")
-			case schedule.Cron == "":
-				log.WithFields(log.Fields{"schedule": schedule.Name, "cron": schedule.Cron}).Warn("Skip execution. Use 'cronicle exec' to run.")
-			default:
-				_, err := c.AddFunc(schedule.Cron, ProduceSchedule(schedule, queue))
-				if err != nil {
-					fmt.Printf("\x1b[31;1m%s\x1b[0m\n", fmt.Sprintf("schedule cron format error: %s", schedule.Name))
-					log.Fatal(err)
-				}
-			}
+	log.WithFields(log.Fields{"cronicle": "heartbeat", "path": cronicleFile}).Info("Refreshing config...")
+	heartbeatReloads.WithLabelValues("reloaded").Inc()
 
+	priorConf, priorEntries := schedulerGlobal.loaded()
+	if force {
+		//a forced load starts the schedules in a new cron, the loaded entries belong to another cron
+		priorConf, priorEntries = nil, map[string]cron.EntryID{}
+	}
+	diff := diffSchedules(DiffConfigs(priorConf, conf), conf)
+	for _, name := range append(diff.Removed, diff.Changed...) {
+		if id, ok := priorEntries[name]; ok {
+			c.Remove(id)
 		}
-		c.Start()
 	}
-	confPriorGlobal = conf
 
+	entries := map[string]cron.EntryID{}
+	for _, schedule := range conf.Schedules {
+		//entries of unchanged schedules are kept if they are entries of the given cron
+		if id, ok := priorEntries[schedule.Name]; ok && diff.unchanged(schedule.Name) && c.Entry(id).Valid() {
+			entries[schedule.Name] = id
+			continue
+		}
+		if diff.unchanged(schedule.Name) && specs[schedule.Name] == nil {
+			continue
+		}
+		switch {
+		case schedule.Cron == "@once":
+			log.WithFields(log.Fields{"schedule": schedule.Name, "cron": schedule.Cron}).Info("@once execution complete at 'cronicle run'")
+		case schedule.Cron == "":
+			log.WithFields(log.Fields{"schedule": schedule.Name, "cron": schedule.Cron}).Warn("Skip execution. Use 'cronicle exec' to run.")
+		default:
+			entries[schedule.Name] = c.Schedule(specs[schedule.Name], cron.FuncJob(schedulerGlobal.produce(schedule, queue)))
+		}
+	}
+	schedulerGlobal.load(conf, entries)
+	acceptConfig(conf)
+	if cronicleFileAbs, err := filepath.Abs(cronicleFile); err == nil {
+		auditReload(filepath.Dir(cronicleFileAbs), conf)
+	}
+
+	log.WithFields(log.Fields{
+		"cronicle":  "heartbeat",
+		"added":     diff.Added,
+		"removed":   diff.Removed,
+		"changed":   diff.Changed,
+		"unchanged": len(diff.Unchanged),
+	}).Info("Reloaded schedules")
+}
+
+//scheduleDiff lists the schedule names that were added, removed, changed
+//or unchanged between two configs
+type scheduleDiff struct {
+	Added     []string
+	Removed   []string
+	Changed   []string
+	Unchanged []string
+}
+
+func (diff scheduleDiff) unchanged(name string) bool {
+	return contains(diff.Unchanged, name)
+}
+
+//diffSchedules lists the schedule names of the DiffConfigs changes by kind, the schedules of conf
+//without a change are unchanged. The audit log records the same changes as the reload applies.
+func diffSchedules(changes []ScheduleChange, conf *Config) scheduleDiff {
+	var diff scheduleDiff
+	changed := map[string]bool{}
+	for _, change := range changes {
+		changed[change.Schedule] = true
+		switch change.Change {
+		case ChangeAdded:
+			diff.Added = append(diff.Added, change.Schedule)
+		case ChangeRemoved:
+			diff.Removed = append(diff.Removed, change.Schedule)
+		case ChangeChanged:
+			diff.Changed = append(diff.Changed, change.Schedule)
+		}
+	}
+	for _, schedule := range conf.Schedules {
+		if !changed[schedule.Name] {
+			diff.Unchanged = append(diff.Unchanged, schedule.Name)
+		}
+	}
+	return diff
+}
+
+//acceptConfig sets conf as the last-known-good confPrior
+func acceptConfig(conf *Config) {
+	setConfPrior(conf)
+	configRejectedGlobal = ""
+	configValid.Set(1)
+}
+
+//rejectConfig logs and counts a config that failed to load, the rejection is notified
+//to the confPrior notify on_failure targets once for each distinct error.
+func rejectConfig(cronicleFile string, err error) {
+	log.WithFields(log.Fields{"cronicle": "heartbeat", "path": cronicleFile}).Error("Rejected config, keeping the last valid config: ", err)
+	heartbeatReloads.WithLabelValues("error").Inc()
+	configValid.Set(0)
+
+	if err.Error() == configRejectedGlobal {
+		return
+	}
+	configRejectedGlobal = err.Error()
+	prior := confPrior()
+	if prior == nil || prior.Notify == nil {
+		return
+	}
+	n := Notification{
+		Event:     EventConfigRejected,
+		Scheduled: time.Now(),
+		Error:     err.Error(),
+	}
+	for _, target := range prior.Notify.OnFailure {
+		if err := target.Send(n); err != nil {
+			log.WithFields(log.Fields{"cronicle": "heartbeat", "notify": target.Type, "event": n.Event}).Error(err)
+		}
+	}
 }
 
 //ConsumeSchedule consumes the byte array of a
-//schedule from the message queue for execution
+//schedule from the message queue for execution, or of a single task dispatched by the scheduler.
+//Messages that do not decode as a known Envelope version are sent to the dead-letter queue.
 func ConsumeSchedule(queue <-chan []byte, path string, wg *sync.WaitGroup) {
 	var p string
 	if path == "" {
@@ -254,50 +539,94 @@ func ConsumeSchedule(queue <-chan []byte, path string, wg *sync.WaitGroup) {
 		wg.Add(1)
 		go func(scheduleBytes []byte) {
 			defer wg.Done()
-			var schedule Schedule
-			err := json.Unmarshal(scheduleBytes, &schedule)
-			if err != nil {
-				log.Error(err)
-			}
-			schedule.PropigateTaskProperties(p)
-			schedule.ExecuteTasks()
+			consumeMessage(context.Background(), scheduleBytes, p)
 		}(scheduleBytes)
 	}
 }
 
-//ProduceSchedule produces the json of a
+//consumeMessage executes the schedule run or dispatched task of a queued message in path,
+//once ctx is done the running tasks are killed.
+func consumeMessage(ctx context.Context, scheduleBytes []byte, path string) {
+	env, schedule, err := DecodeEnvelope(scheduleBytes)
+	if err != nil {
+		deadLetter(scheduleBytes, err)
+		return
+	}
+	schedule.PropigateTaskProperties(path)
+	for i := range schedule.Tasks {
+		schedule.Tasks[i].lastSuccess = env.LastSuccess
+	}
+	if env.Dispatch != nil {
+		defer localWorker.begin(schedule, env.Dispatch.Task)()
+		consumeRun(ctx, dispatchID(schedule.RunID, env.Dispatch.Task), schedule.Name, func() { executeDispatched(ctx, schedule, *env.Dispatch) })
+		return
+	}
+	schedulesConsumed.WithLabelValues(schedule.Name).Inc()
+	defer localWorker.begin(schedule, "")()
+	consumeRun(ctx, schedule.RunID, schedule.Name, func() { schedule.ExecuteWithPolicyContext(ctx, scheduleLocker) })
+}
+
+//ProduceSchedule produces the Envelope of a
 //schdule to the message queue for consumption
 func ProduceSchedule(schedule Schedule, queue chan<- []byte) func() {
 	return func() {
-		log.WithFields(log.Fields{"schedule": schedule.Name}).Info("Queuing...")
-		var loc *time.Location
-		if schedule.Timezone != "" {
-			loc, _ = time.LoadLocation(schedule.Timezone)
-		} else {
-			loc = time.Local
-		}
-
-		schedule.Now = time.Now().In(loc)
+		ProduceScheduleAt(schedule, queue, time.Now())
+	}
+}
 
-		var endDate time.Time
-		if schedule.EndDate == "" {
-			//if EndDate is not given, default to 1 Year from now
-			endDate = schedule.Now.Add(time.Duration(1) * time.Hour * 24 * 365)
-		} else {
-			endDate, _ = time.Parse("2006-01-02", schedule.EndDate)
+//ProduceScheduleAt produces the json of a schedule with schedule.Now = now
+//to the message queue for consumption and records now as the last fire time
+//of the schedule, unless a later fire time was recorded, i.e. by a trigger of a past time.
+func ProduceScheduleAt(schedule Schedule, queue chan<- []byte, now time.Time) {
+	queueSchedule(schedule, queue, now)
+
+	if schedule.CroniclePath != "" {
+		history := NewHistory(schedule.CroniclePath)
+		last, err := history.LastFire(schedule.Name)
+		if err == nil && now.After(last) {
+			err = history.SetLastFire(schedule.Name, now.In(scheduleLocation(schedule)))
 		}
-		startDate, _ := time.Parse("2006-01-02", schedule.StartDate)
-		if schedule.Now.After(endDate) || schedule.Now.Before(startDate) {
-			s := fmt.Sprintf("now=%s is not between start_date=%s and end_date=%s... Schedule will not execute.", schedule.Now, startDate, endDate)
-			log.WithFields(log.Fields{
-				"schedule": schedule.Name,
-			}).Warn(s)
-		} else {
-			schedule.CleanGit()
-			queue <- schedule.JSON()
+		if err != nil {
+			log.WithFields(log.Fields{"schedule": schedule.Name}).Error(err)
 		}
+	}
+}
+
+//queueSchedule produces the json of a schedule with schedule.Now = now to the
+//message queue if now is between the schedule start and end dates.
+func queueSchedule(schedule Schedule, queue chan<- []byte, now time.Time) {
+	log.WithFields(log.Fields{"schedule": schedule.Name}).Info("Queuing...")
+	schedule.Now = now.In(scheduleLocation(schedule))
+	schedule.RunID = newID()
+
+	var endDate time.Time
+	if schedule.EndDate == "" {
+		//if EndDate is not given, default to 1 Year from now
+		endDate = schedule.Now.Add(time.Duration(1) * time.Hour * 24 * 365)
+	} else {
+		endDate, _ = time.Parse("2006-01-02", schedule.EndDate)
+	}
+	startDate, _ := time.Parse("2006-01-02", schedule.StartDate)
+	if schedule.Now.After(endDate) || schedule.Now.Before(startDate) {
+		s := fmt.Sprintf("now=%s is not between start_date=%s and end_date=%s... Schedule will not execute.", schedule.Now, startDate, endDate)
+		log.WithFields(log.Fields{
+			"schedule": schedule.Name,
+		}).Warn(s)
+	} else {
+		schedule.CleanGit()
+		produce(queue, schedule)
+		schedulesQueued.WithLabelValues(schedule.Name).Inc()
+	}
+}
 
+//scheduleLocation returns the location of schedule.Timezone, or time.Local if not given
+func scheduleLocation(schedule Schedule) *time.Location {
+	if schedule.Timezone != "" {
+		if loc, err := time.LoadLocation(schedule.Timezone); err == nil {
+			return loc
+		}
 	}
+	return time.Local
 }
 
 // ExecTasks parses the cronicle.hcl config, filters for a specified task
@@ -332,6 +661,8 @@ func ExecTasks(cronicleFile string, taskName string, scheduleName string, now ti
 		FullTimestamp: true,
 	}, loc: loc})
 	log.WithFields(log.Fields{"cronicle": "exec"}).Info("executing tasks...")
+	//the notifications of the executed tasks are sent to the notify targets of conf
+	setConfPrior(conf)
 
 	nowInLoc := now.In(loc)
 	var schedules []Schedule
@@ -37,5 +37,6 @@ var _ = AfterSuite(func() {
 	os.RemoveAll("./testconfig")
 	os.RemoveAll("./test_repo/")
 	os.RemoveAll("./test_task/")
+	os.RemoveAll("./.cronicle/")
 
 })
@@ -1,6 +1,10 @@
 package cronicle
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/terraform/dag"
@@ -27,18 +31,55 @@ func (schedule *Schedule) taskGraph() dag.AcyclicGraph {
 	return g
 }
 
+//validateGraph checks that each task.Depends names a task of the schedule
+//and that the task dependencies have no cycles
+func (schedule *Schedule) validateGraph() error {
+	taskMap := schedule.TaskMap()
+	for _, task := range schedule.Tasks {
+		for _, dep := range task.Depends {
+			if _, ok := taskMap[dep]; !ok {
+				return fmt.Errorf(`schedule "%s" {} task "%s" {} depends on task "%s" which does not exist`, schedule.Name, task.Name, dep)
+			}
+			if dep == task.Name {
+				return fmt.Errorf(`schedule "%s" {} task "%s" {} depends on itself`, schedule.Name, task.Name)
+			}
+		}
+	}
+	g := schedule.taskGraph()
+	if cycles := g.Cycles(); len(cycles) > 0 {
+		names := []string{}
+		for _, v := range cycles[0] {
+			names = append(names, dag.VertexName(v))
+		}
+		return fmt.Errorf(`schedule "%s" {} has a dependency cycle between tasks %s`, schedule.Name, strings.Join(names, ", "))
+	}
+	return nil
+}
+
 // ExecuteTasks handels the execution of all tasks in a given schedule.
 // The execution walks over a DAG[Directed Acyclic Graph] to determine
 // execution order, which will default to parallel unless task.depends is
 // specified.
 func (schedule Schedule) ExecuteTasks() {
+	schedule.ExecuteTasksContext(context.Background())
+}
+
+// ExecuteTasksContext is ExecuteTasks with a context, once ctx is done running
+// tasks are killed and tasks that have not started are not executed.
+func (schedule Schedule) ExecuteTasksContext(ctx context.Context) {
 	var now time.Time
 	if (schedule.Now == time.Time{}) {
 		now = time.Now().In(time.Local)
 	} else {
 		now = schedule.Now
 	}
+	schedule.Now = now
+	if schedule.RunID == "" {
+		schedule.RunID = newID()
+	}
 
+	start := time.Now()
+	schedule.Tasks = schedule.expandTasks()
 	taskMap := schedule.TaskMap()
 	taskGraph := schedule.taskGraph()
 	graphString := taskGraph.StringWithNodeTypes()
@@ -47,22 +88,78 @@ func (schedule Schedule) ExecuteTasks() {
 		"clock":    now.Format(time.Kitchen),
 		"date":     now.Format(time.RFC850),
 	}).Info(graphString)
-	err := taskGraph.Walk(func(v dag.Vertex) tfdiags.Diagnostics {
-		var diags tfdiags.Diagnostics
+	//Tasks never return diagnostics to the walk so that every vertex is visited,
+	//task.TriggerRule then decides if a task executes given the states of its dependencies.
+	states := newTaskStates()
+	var mu sync.Mutex
+	var diags tfdiags.Diagnostics
+	taskGraph.Walk(func(v dag.Vertex) tfdiags.Diagnostics {
 		taskName := dag.VertexName(v)
 		task := taskMap[taskName]
-		_, err := task.Execute(now)
+		if ctx.Err() != nil {
+			states.set(taskName, StatusFailed)
+			mu.Lock()
+			diags = diags.Append(ctx.Err())
+			mu.Unlock()
+			return nil
+		}
+		skip := func(reason string) {
+			log.WithFields(log.Fields{
+				"schedule": schedule.Name,
+				"task":     taskName,
+			}).Warn("Skipped, " + reason)
+			task.RecordSkipped(now, reason)
+			states.set(taskName, StatusSkipped)
+		}
+		if ok, reason := task.triggered(states); !ok {
+			skip(reason)
+			return nil
+		}
+		task.upstream = states.allOutputs()
+		task.runID = schedule.RunID
+		task.executor = schedule.executor
 
-		if err != nil {
-			diags = diags.Append(err)
-			return diags
+		var err error
+		if task.ForEach != nil {
+			//for_each lists that were not expanded in the graph are resolved from the upstream outputs
+			var values []string
+			values, err = task.forEachValues()
+			if err == nil && len(values) == 0 {
+				skip("for_each is empty")
+				return nil
+			}
+			if err == nil {
+				err = task.executeInstances(ctx, now, values, states)
+			}
+		} else {
+			err = task.execute(ctx, now)
 		}
 
-		return diags
+		if err != nil {
+			states.set(taskName, StatusFailed)
+			mu.Lock()
+			diags = diags.Append(fmt.Errorf("task %s: %w", taskName, err))
+			mu.Unlock()
+			return nil
+		}
+		states.setOutputs(taskName, task.outputs)
+		states.set(taskName, StatusSuccess)
+		return nil
 	})
 
-	if err != nil {
-		log.Error(err.Err())
+	log.WithFields(log.Fields{
+		"schedule":  schedule.Name,
+		"succeeded": states.names(StatusSuccess),
+		"failed":    states.names(StatusFailed),
+		"skipped":   states.names(StatusSkipped),
+	}).Info("Run summary")
+
+	if diags.HasErrors() {
+		log.Error(diags.Err())
+		schedule.Record(start, diags.Err())
+	} else {
+		schedule.Record(start, nil)
 	}
+	schedule.PruneRunLogs(time.Now())
 
 }
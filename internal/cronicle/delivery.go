@@ -0,0 +1,368 @@
+package cronicle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//DeliveryAtMostOnce produces each schedule run to the queue once [default]
+	DeliveryAtMostOnce = "at_most_once"
+	//DeliveryAtLeastOnce redelivers a schedule run until a worker acknowledges that it completed
+	DeliveryAtLeastOnce = "at_least_once"
+
+	//DefaultVisibilityTimeout is the time a claimed run may go without an ack before it is redelivered
+	DefaultVisibilityTimeout = 5 * time.Minute
+	//MinVisibilityTimeout leaves room for the worker acks sent every ackInterval
+	MinVisibilityTimeout = time.Minute
+	//maxDeliveries caps the number of times a run is delivered
+	maxDeliveries = 5
+)
+
+//ackInterval is the interval at which a worker acks the progress of a running schedule,
+//which extends the visibility timeout of the run and the claim of the worker on the run.
+var ackInterval = 20 * time.Second
+
+//Ack acknowledges the delivery of a schedule run. A worker acks a run once it claimed it,
+//every ackInterval while it executes and once with Done when the run completed.
+type Ack struct {
+	RunID string
+	Done  bool
+}
+
+//deliveryGlobal tracks the runs produced by this process when the queue delivery is at_least_once
+var deliveryGlobal *Delivery
+
+//Delivery tracks the schedule runs produced to the queue until a worker acks
+//that they completed. A run is redelivered once the worker that claimed it has not acked
+//it within the visibility timeout, runs waiting in the queue for a worker are not redelivered.
+type Delivery struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	pending map[string]*pendingRun
+}
+
+type pendingRun struct {
+	schedule string
+	body     []byte
+	queue    chan<- []byte
+	//claimed is set by the ack of the worker that claimed the last delivery of the run
+	claimed    bool
+	deadline   time.Time
+	deliveries int
+}
+
+//NewDelivery returns a Delivery with the given visibility timeout
+func NewDelivery(timeout time.Duration) *Delivery {
+	return &Delivery{timeout: timeout, pending: map[string]*pendingRun{}}
+}
+
+//Send produces the schedule envelope to queue and tracks the run until it is acked
+func (d *Delivery) Send(queue chan<- []byte, schedule Schedule) {
+	d.send(queue, schedule.RunID, schedule.Name, NewEnvelope(schedule).JSON())
+}
+
+//send produces body to queue and tracks it by id until it is acked
+func (d *Delivery) send(queue chan<- []byte, id string, scheduleName string, body []byte) {
+	d.mu.Lock()
+	d.pending[id] = &pendingRun{
+		schedule:   scheduleName,
+		body:       body,
+		queue:      queue,
+		deliveries: 1,
+	}
+	d.mu.Unlock()
+	queue <- body
+}
+
+//Ack starts or extends the visibility timeout of a claimed run, or stops tracking a completed run
+func (d *Delivery) Ack(ack Ack) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	run, ok := d.pending[ack.RunID]
+	if !ok {
+		return
+	}
+	if ack.Done {
+		delete(d.pending, ack.RunID)
+		return
+	}
+	run.claimed = true
+	run.deadline = time.Now().Add(d.timeout)
+}
+
+//Pending returns the number of runs that have not been acked as done
+func (d *Delivery) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pending)
+}
+
+//Redeliver produces the claimed runs whose visibility timeout expired before now to their queue
+//again, a run that was delivered maxDeliveries times is sent to the dead-letter queue.
+func (d *Delivery) Redeliver(now time.Time) {
+	d.mu.Lock()
+	var expired []*pendingRun
+	dropped := map[string]*pendingRun{}
+	for runID, run := range d.pending {
+		if !run.claimed || now.Before(run.deadline) {
+			continue
+		}
+		fields := log.Fields{"schedule": run.schedule, "run": runID, "deliveries": run.deliveries}
+		if run.deliveries >= maxDeliveries {
+			log.WithFields(fields).Error("Run was not acked after the max deliveries, dropping")
+			delete(d.pending, runID)
+			dropped[runID] = run
+			continue
+		}
+		log.WithFields(fields).Warn("Run was not acked within the visibility timeout, redelivering")
+		run.deliveries++
+		//the visibility timeout starts again once a worker claims the redelivery
+		run.claimed = false
+		expired = append(expired, run)
+	}
+	d.mu.Unlock()
+
+	for _, run := range expired {
+		run.queue <- run.body
+		schedulesRedelivered.WithLabelValues(run.schedule).Inc()
+	}
+	for runID, run := range dropped {
+		err := fmt.Errorf("run was not acked after %d deliveries", run.deliveries)
+		deadLetter(run.body, err)
+		taskDispatcher.drop(runID, err)
+	}
+}
+
+//start redelivers expired runs until the process exits
+func (d *Delivery) start() {
+	interval := d.timeout / 4
+	if interval > ackInterval {
+		interval = ackInterval
+	}
+	for now := range time.Tick(interval) {
+		d.Redeliver(now)
+	}
+}
+
+//produce sends the schedule envelope to queue, or the label queue of its run_on labels,
+//and tracks the run if the delivery is at_least_once. The tasks of a schedule with
+//dispatch = "task" are produced on their own by the taskDispatcher.
+func produce(queue chan<- []byte, schedule Schedule) {
+	if schedule.Dispatch == DispatchTask && taskDispatcher != nil {
+		go taskDispatcher.Coordinate(queue, schedule)
+		return
+	}
+	produceMessage(queueRouter.Route(queue, schedule), schedule.RunID, schedule.Name, NewEnvelope(schedule).JSON())
+}
+
+//produceMessage sends body to queue, and tracks it by id if the delivery is at_least_once
+func produceMessage(queue chan<- []byte, id string, scheduleName string, body []byte) {
+	if deliveryGlobal != nil {
+		deliveryGlobal.send(queue, id, scheduleName, body)
+		return
+	}
+	queue <- body
+}
+
+//Claim states of a run returned by RunClaimer.Claim
+const (
+	//ClaimAcquired is returned to the worker that claimed the run
+	ClaimAcquired = "acquired"
+	//ClaimRunning is returned if the run is claimed by a running worker
+	ClaimRunning = "running"
+	//ClaimDone is returned if the run completed
+	ClaimDone = "done"
+)
+
+//runClaimer detects duplicate deliveries of the runs consumed by this process,
+//Run and StartWorker replace it with a RedisClaimer in distributed redis mode.
+var runClaimer RunClaimer = NewLocalClaimer()
+
+//RunClaimer claims schedule runs by run id so that a run delivered more than once is executed once.
+//A claim expires after ttl unless it is extended, so that the run of a dead worker is executed on
+//redelivery, and a completed run is remembered for doneTTL.
+type RunClaimer interface {
+	//Claim claims the run for ttl and returns ClaimAcquired, or ClaimRunning or ClaimDone
+	//if the run is already claimed.
+	Claim(runID string, ttl time.Duration) (string, error)
+	//Extend extends the claim of a running run for ttl
+	Extend(runID string, ttl time.Duration) error
+	//Done marks the run as completed
+	Done(runID string) error
+}
+
+//doneTTL is how long a completed run id is remembered to detect late duplicate deliveries
+const doneTTL = 24 * time.Hour
+
+//claimSweepInterval is how often a LocalClaimer removes its expired claims
+const claimSweepInterval = time.Minute
+
+type localClaim struct {
+	state   string
+	expires time.Time
+}
+
+//LocalClaimer is an in process RunClaimer for single process and per worker deduplication.
+type LocalClaimer struct {
+	mu     sync.Mutex
+	claims map[string]localClaim
+	swept  time.Time
+}
+
+//NewLocalClaimer returns an empty LocalClaimer
+func NewLocalClaimer() *LocalClaimer {
+	return &LocalClaimer{claims: map[string]localClaim{}}
+}
+
+//Claim claims the run in process
+func (l *LocalClaimer) Claim(runID string, ttl time.Duration) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if now.Sub(l.swept) > claimSweepInterval {
+		l.sweep(now)
+	}
+	if claim, ok := l.claims[runID]; ok && !now.After(claim.expires) {
+		return claim.state, nil
+	}
+	l.claims[runID] = localClaim{state: ClaimRunning, expires: now.Add(ttl)}
+	return ClaimAcquired, nil
+}
+
+//sweep removes the expired claims, Claim calls it at most once per claimSweepInterval
+//so that a claim does not scan every run remembered for doneTTL.
+func (l *LocalClaimer) sweep(now time.Time) {
+	for id, claim := range l.claims {
+		if now.After(claim.expires) {
+			delete(l.claims, id)
+		}
+	}
+	l.swept = now
+}
+
+//Extend extends the in process claim
+func (l *LocalClaimer) Extend(runID string, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if claim, ok := l.claims[runID]; ok && claim.state == ClaimRunning {
+		claim.expires = time.Now().Add(ttl)
+		l.claims[runID] = claim
+	}
+	return nil
+}
+
+//Done marks the in process claim as completed
+func (l *LocalClaimer) Done(runID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.claims[runID] = localClaim{state: ClaimDone, expires: time.Now().Add(doneTTL)}
+	return nil
+}
+
+//RedisClaimer is a RunClaimer that holds run claims in redis so that duplicate
+//deliveries are detected across distributed workers.
+type RedisClaimer struct {
+	client *redis.Client
+	prefix string
+}
+
+//NewRedisClaimer returns a RedisClaimer for the given client.
+func NewRedisClaimer(client *redis.Client) *RedisClaimer {
+	return &RedisClaimer{client: client, prefix: "cronicle:run:"}
+}
+
+//extendScript extends the claim if the run is still running
+var extendScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == "running" then
+	return redis.call("pexpire", KEYS[1], ARGV[1])
+end
+return 0`)
+
+//Claim claims the run in redis
+func (l *RedisClaimer) Claim(runID string, ttl time.Duration) (string, error) {
+	key := l.prefix + runID
+	ok, err := l.client.SetNX(key, ClaimRunning, ttl).Result()
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return ClaimAcquired, nil
+	}
+	state, err := l.client.Get(key).Result()
+	if err == redis.Nil {
+		//the claim expired in between, try again
+		return l.Claim(runID, ttl)
+	}
+	return state, err
+}
+
+//Extend extends the redis claim
+func (l *RedisClaimer) Extend(runID string, ttl time.Duration) error {
+	return extendScript.Run(l.client, []string{l.prefix + runID}, ttl.Milliseconds()).Err()
+}
+
+//Done marks the redis claim as completed
+func (l *RedisClaimer) Done(runID string) error {
+	return l.client.Set(l.prefix+runID, ClaimDone, doneTTL).Err()
+}
+
+//consumeRun executes a delivered schedule run or dispatched task once by its delivery id,
+//duplicate deliveries that are running or completed are skipped. The delivery is acked
+//once it is claimed, every ackInterval while it executes and once it completed. A run that is cancelled with
+//ctx by the drain of the worker is not acked as completed so that it is redelivered.
+func consumeRun(ctx context.Context, id string, scheduleName string, execute func()) {
+	if id == "" {
+		execute()
+		return
+	}
+	fields := log.Fields{"schedule": scheduleName, "run": id}
+	ttl := 3 * ackInterval
+	state, err := runClaimer.Claim(id, ttl)
+	if err != nil {
+		log.WithFields(fields).Error(err)
+	}
+	switch state {
+	case ClaimRunning:
+		log.WithFields(fields).Warn("Skip duplicate delivery, the run is executing")
+		return
+	case ClaimDone:
+		//the done ack of the run may have been lost
+		log.WithFields(fields).Warn("Skip duplicate delivery, the run completed")
+		report(RunResult{Ack: &Ack{RunID: id, Done: true}})
+		return
+	}
+
+	report(RunResult{Ack: &Ack{RunID: id}})
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ackInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := runClaimer.Extend(id, ttl); err != nil {
+					log.WithFields(fields).Error(err)
+				}
+				report(RunResult{Ack: &Ack{RunID: id}})
+			}
+		}
+	}()
+	execute()
+	close(done)
+	if ctx.Err() != nil {
+		log.WithFields(fields).Warn("Run was cancelled by the worker drain, leaving it to be redelivered")
+		return
+	}
+	if err := runClaimer.Done(id); err != nil {
+		log.WithFields(fields).Error(err)
+	}
+	report(RunResult{Ack: &Ack{RunID: id, Done: true}})
+}
@@ -0,0 +1,116 @@
+package cronicle_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Delivery", func() {
+	var deliveryPath string
+
+	BeforeEach(func() {
+		deliveryPath, _ = filepath.Abs("./test_delivery/")
+		os.MkdirAll(deliveryPath, 0777)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(deliveryPath)
+	})
+
+	It("Delivery should redeliver a claimed run that is not acked within the visibility timeout", func() {
+		queue := make(chan []byte, 10)
+		d := cronicle.NewDelivery(time.Minute)
+		schedule := cronicle.Schedule{Name: "foo", RunID: "run1"}
+		d.Send(queue, schedule)
+		Expect(len(queue)).To(Equal(1))
+		body := <-queue
+
+		//the run waits in the queue until a worker claims it
+		d.Redeliver(time.Now().Add(2 * time.Minute))
+		Expect(len(queue)).To(Equal(0))
+
+		d.Ack(cronicle.Ack{RunID: "run1"})
+		d.Redeliver(time.Now())
+		Expect(len(queue)).To(Equal(0))
+		d.Redeliver(time.Now().Add(2 * time.Minute))
+		Expect(len(queue)).To(Equal(1))
+		Expect(string(<-queue)).To(Equal(string(body)))
+
+		d.Ack(cronicle.Ack{RunID: "run1"})
+		d.Redeliver(time.Now().Add(30 * time.Second))
+		Expect(len(queue)).To(Equal(0))
+		Expect(d.Pending()).To(Equal(1))
+
+		d.Ack(cronicle.Ack{RunID: "run1", Done: true})
+		Expect(d.Pending()).To(Equal(0))
+		d.Redeliver(time.Now().Add(time.Hour))
+		Expect(len(queue)).To(Equal(0))
+	})
+
+	It("Delivery should drop a run after the max deliveries", func() {
+		queue := make(chan []byte, 10)
+		d := cronicle.NewDelivery(time.Minute)
+		d.Send(queue, cronicle.Schedule{Name: "foo", RunID: "run1"})
+		d.Send(queue, cronicle.Schedule{Name: "foo", RunID: "unclaimed"})
+		now := time.Now()
+		for i := 1; i <= 10; i++ {
+			d.Ack(cronicle.Ack{RunID: "run1"})
+			d.Redeliver(now.Add(time.Duration(i) * 2 * time.Minute))
+		}
+		Expect(len(queue)).To(Equal(6))
+		Expect(d.Pending()).To(Equal(1))
+	})
+
+	It("LocalClaimer should claim a run once and remember completed runs", func() {
+		claimer := cronicle.NewLocalClaimer()
+		state, err := claimer.Claim("run1", time.Minute)
+		Expect(err).To(BeNil())
+		Expect(state).To(Equal(cronicle.ClaimAcquired))
+		state, _ = claimer.Claim("run1", time.Minute)
+		Expect(state).To(Equal(cronicle.ClaimRunning))
+		claimer.Done("run1")
+		state, _ = claimer.Claim("run1", time.Minute)
+		Expect(state).To(Equal(cronicle.ClaimDone))
+
+		claimer.Claim("run2", time.Millisecond)
+		time.Sleep(5 * time.Millisecond)
+		state, _ = claimer.Claim("run2", time.Minute)
+		Expect(state).To(Equal(cronicle.ClaimAcquired))
+	})
+
+	It("ConsumeSchedule should execute a run delivered twice once", func() {
+		schedule := cronicle.Schedule{Name: "foo", Now: time.Now(), RunID: "dedupe-run"}
+		schedule.Tasks = []cronicle.Task{{Name: "bar", Command: []string{"/bin/sleep", "0.2"}}}
+
+		var wg sync.WaitGroup
+		queue := make(chan []byte)
+		go cronicle.ConsumeSchedule(queue, deliveryPath, &wg)
+		queue <- schedule.JSON()
+		queue <- schedule.JSON()
+		time.Sleep(50 * time.Millisecond)
+		wg.Wait()
+		queue <- schedule.JSON()
+		wg.Wait()
+		close(queue)
+
+		records, err := cronicle.NewHistory(deliveryPath).Query(cronicle.HistoryFilter{Task: "bar"})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(1))
+	})
+
+	It("conf.Validate() should error on an unknown delivery or a short visibility timeout", func() {
+		conf := cronicle.Default()
+		conf.Queue = &cronicle.Queue{Delivery: "exactly_once"}
+		Expect(conf.Validate()).ToNot(BeNil())
+		conf.Queue = &cronicle.Queue{Delivery: cronicle.DeliveryAtLeastOnce, VisibilityTimeout: "10s"}
+		Expect(conf.Validate()).ToNot(BeNil())
+		conf.Queue = &cronicle.Queue{Delivery: cronicle.DeliveryAtLeastOnce, VisibilityTimeout: "10m"}
+		Expect(conf.Validate()).To(BeNil())
+	})
+})
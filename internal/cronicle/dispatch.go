@@ -0,0 +1,274 @@
+package cronicle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//DispatchSchedule produces the schedule run to one worker, which executes all of its tasks [default]
+	DispatchSchedule = "schedule"
+	//DispatchTask walks the task graph on the scheduler and produces each ready task to any worker
+	DispatchTask = "task"
+)
+
+//taskDispatcher coordinates the schedule runs with dispatch = "task" produced by this process,
+//Run sets it in distributed mode. Without a dispatcher all tasks of a run execute on one worker.
+var taskDispatcher *Dispatcher
+
+//TaskDispatch is the task of a schedule run carried by an Envelope when the task is dispatched on its own
+type TaskDispatch struct {
+	//Task is the name of the task in the schedule
+	Task string
+	//EachValue is the for_each value of a task instance
+	EachValue string `json:",omitempty"`
+	//Upstream are the outputs of the completed tasks of the run, by task name
+	Upstream map[string]map[string]string `json:",omitempty"`
+}
+
+//TaskResult is the outcome of a dispatched task, reported by the worker that executed it
+type TaskResult struct {
+	RunID    string
+	Schedule string
+	Task     string
+	Status   string
+	Error    string            `json:",omitempty"`
+	Outputs  map[string]string `json:",omitempty"`
+}
+
+//taskExecutor executes the tasks of a schedule run
+type taskExecutor interface {
+	executeTask(ctx context.Context, task *Task, t time.Time) error
+}
+
+//execute executes the task with the executor of its schedule run, or in process if there is none
+func (task *Task) execute(ctx context.Context, t time.Time) error {
+	if task.executor != nil {
+		return task.executor.executeTask(ctx, task, t)
+	}
+	_, err := task.ExecuteContext(ctx, t)
+	return err
+}
+
+//dispatchID identifies the delivery of a dispatched task, i.e. "<run id>/bar[a]"
+func dispatchID(runID string, taskName string) string {
+	return runID + "/" + taskName
+}
+
+//Dispatcher produces the ready tasks of schedule runs to the queue and waits
+//for the TaskResult of each before the dependent tasks are released.
+type Dispatcher struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	waiting map[string]chan TaskResult
+	//dispatched is the time each task in flight was produced to the queue
+	dispatched map[string]time.Time
+	//executing is the worker heartbeat that last listed each dispatched task in flight
+	executing map[string]WorkerStatus
+}
+
+//NewDispatcher returns a Dispatcher without tasks in flight, Watch fails the tasks that are not
+//listed by a worker heartbeat within timeout of their dispatch
+func NewDispatcher(timeout time.Duration) *Dispatcher {
+	return &Dispatcher{
+		timeout:    timeout,
+		waiting:    map[string]chan TaskResult{},
+		dispatched: map[string]time.Time{},
+		executing:  map[string]WorkerStatus{},
+	}
+}
+
+//Complete delivers the result of a dispatched task to the schedule run waiting for it,
+//results of tasks that are not in flight are ignored. Complete of a nil Dispatcher is a no-op.
+func (d *Dispatcher) Complete(result TaskResult) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	id := dispatchID(result.RunID, result.Task)
+	if ch, ok := d.waiting[id]; ok {
+		ch <- result
+		delete(d.waiting, id)
+		delete(d.dispatched, id)
+		delete(d.executing, id)
+	}
+}
+
+//InFlight returns the number of dispatched tasks waiting for a result
+func (d *Dispatcher) InFlight() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.waiting)
+}
+
+//drop fails a dispatched task whose delivery was dropped after the max deliveries
+func (d *Dispatcher) drop(id string, err error) {
+	if d == nil {
+		return
+	}
+	runID := strings.SplitN(id, "/", 2)
+	if len(runID) != 2 {
+		return
+	}
+	d.Complete(TaskResult{RunID: runID[0], Task: runID[1], Status: StatusFailed, Error: err.Error()})
+}
+
+//Watch fails the dispatched tasks in flight whose result will not arrive, given the last status
+//of each worker at now: no worker listed the task in its heartbeat within the dispatch timeout,
+//i.e. the worker that took it from the queue died before it started the task, the worker executing
+//the task is dead or stopped, or it has not listed the task in its heartbeats for workerDeadAfter
+//without reporting its result. Watch is only used with queue delivery = "at_most_once", otherwise
+//the task is redelivered to another worker.
+func (d *Dispatcher) Watch(workers []WorkerStatus, now time.Time) {
+	d.mu.Lock()
+	current := map[string]WorkerStatus{}
+	for _, status := range workers {
+		current[status.ID] = status
+		for _, run := range status.Runs {
+			id := dispatchID(run.RunID, run.Task)
+			if _, ok := d.waiting[id]; ok && run.Task != "" {
+				d.executing[id] = status
+			}
+		}
+	}
+	lost := map[string]error{}
+	for id, dispatched := range d.dispatched {
+		if _, ok := d.executing[id]; !ok && now.Sub(dispatched) > d.timeout {
+			lost[id] = fmt.Errorf("task was not started by a worker within %s", d.timeout)
+		}
+	}
+	for id, listed := range d.executing {
+		status, ok := current[listed.ID]
+		if !ok {
+			continue
+		}
+		switch state := status.State(now); {
+		case state == WorkerDead || state == WorkerStopped:
+			lost[id] = fmt.Errorf("worker %s executing the task is %s", status.ID, state)
+		case status.LastSeen.Sub(listed.LastSeen) > workerDeadAfter:
+			lost[id] = fmt.Errorf("worker %s completed the task without reporting its result", status.ID)
+		}
+	}
+	d.mu.Unlock()
+
+	for id, err := range lost {
+		log.WithFields(log.Fields{"run": id}).Error(err)
+		d.drop(id, err)
+	}
+}
+
+//start watches the workers executing the dispatched tasks until the process exits
+func (d *Dispatcher) start() {
+	for now := range time.Tick(workerHeartbeatInterval) {
+		d.Watch(workerRegistry.list(now), now)
+	}
+}
+
+//wait registers a dispatched task and returns the channel its result is delivered to
+func (d *Dispatcher) wait(id string) chan TaskResult {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ch := make(chan TaskResult, 1)
+	d.waiting[id] = ch
+	d.dispatched[id] = time.Now()
+	return ch
+}
+
+//forget stops waiting for a dispatched task
+func (d *Dispatcher) forget(id string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.waiting, id)
+	delete(d.dispatched, id)
+	delete(d.executing, id)
+}
+
+//Coordinate executes the schedule run on this process, the task graph is walked here and each
+//ready task is produced to queue, or the label queue of its run_on labels, for any worker to execute.
+func (d *Dispatcher) Coordinate(queue chan<- []byte, schedule Schedule) {
+	log.WithFields(log.Fields{"schedule": schedule.Name, "run": schedule.RunID}).Info("Dispatching tasks...")
+	schedule.executor = remoteTasks{dispatcher: d, queue: queue, schedule: schedule}
+	schedule.ExecuteWithPolicy(scheduleLocker)
+}
+
+//remoteTasks executes the tasks of a schedule run on the workers
+type remoteTasks struct {
+	dispatcher *Dispatcher
+	queue      chan<- []byte
+	schedule   Schedule
+}
+
+//executeTask produces the task to the queue and waits for its result, or for ctx to be done.
+//A task that is running on a worker is not cancelled with ctx.
+func (r remoteTasks) executeTask(ctx context.Context, task *Task, t time.Time) error {
+	id := dispatchID(r.schedule.RunID, task.Name)
+	results := r.dispatcher.wait(id)
+	defer r.dispatcher.forget(id)
+
+	schedule := r.schedule
+	schedule.Now = t
+	env := NewEnvelope(schedule)
+	env.Dispatch = &TaskDispatch{Task: task.Name, Upstream: task.upstream}
+	if task.eachValue != "" {
+		//the worker resolves the for_each instance from the task of the schedule
+		env.Dispatch.Task = strings.TrimSuffix(task.Name, "["+instanceKey(task.eachValue)+"]")
+		env.Dispatch.EachValue = task.eachValue
+	}
+	labels := append(append([]string{}, schedule.RunOn...), task.RunOn...)
+	produceMessage(queueRouter.RouteLabels(r.queue, labels), id, schedule.Name, env.JSON())
+	tasksDispatched.WithLabelValues(schedule.Name, task.Name).Inc()
+	log.WithFields(log.Fields{"schedule": schedule.Name, "task": task.Name, "run": schedule.RunID}).Info("Dispatched")
+
+	select {
+	case result := <-results:
+		task.outputs = result.Outputs
+		if result.Status != StatusSuccess {
+			return errors.New(result.Error)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//executeDispatched executes the dispatched task of a schedule run consumed by a worker
+//and reports its TaskResult to the scheduler. A task cancelled with ctx by the drain of the
+//worker is not reported, it is redelivered, or failed by the scheduler once the worker stopped.
+func executeDispatched(ctx context.Context, schedule Schedule, dispatch TaskDispatch) {
+	result := TaskResult{RunID: schedule.RunID, Schedule: schedule.Name, Task: dispatch.Task, Status: StatusSuccess}
+	if dispatch.EachValue != "" {
+		result.Task = Task{Name: dispatch.Task}.instance(dispatch.EachValue).Name
+	}
+	task, ok := schedule.TaskMap()[dispatch.Task]
+	if !ok {
+		result.Status = StatusFailed
+		result.Error = fmt.Sprintf("task %q not found in schedule %q", dispatch.Task, schedule.Name)
+		log.WithFields(log.Fields{"schedule": schedule.Name, "run": schedule.RunID}).Error(result.Error)
+		report(RunResult{Task: &result})
+		return
+	}
+	if dispatch.EachValue != "" {
+		task = task.instance(dispatch.EachValue)
+	}
+	task.upstream = dispatch.Upstream
+	task.runID = schedule.RunID
+
+	_, err := task.ExecuteContext(ctx, schedule.Now)
+	if ctx.Err() != nil {
+		log.WithFields(log.Fields{"schedule": schedule.Name, "task": result.Task, "run": schedule.RunID}).Warn("Task was cancelled by the worker drain, not reporting its result")
+		return
+	}
+	if err != nil {
+		result.Status = StatusFailed
+		result.Error = err.Error()
+	}
+	result.Outputs = task.outputs
+	report(RunResult{Task: &result})
+}
@@ -0,0 +1,169 @@
+package cronicle_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Dispatch", func() {
+	var dispatchPath string
+
+	BeforeEach(func() {
+		dispatchPath, _ = filepath.Abs("./test_dispatch/")
+		os.MkdirAll(dispatchPath, 0777)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dispatchPath)
+	})
+
+	It("Dispatcher.Coordinate should produce each task once its dependencies completed", func() {
+		schedule := cronicle.Schedule{Name: "foo", Now: time.Now(), RunID: "dispatch-run", Dispatch: cronicle.DispatchTask}
+		schedule.Tasks = []cronicle.Task{
+			{Name: "a"},
+			{Name: "b", Depends: []string{"a"}},
+			{Name: "c", Depends: []string{"a"}},
+		}
+		schedule.PropigateTaskProperties(dispatchPath)
+
+		d := cronicle.NewDispatcher(time.Minute)
+		queue := make(chan []byte, 10)
+		done := make(chan struct{})
+		go func() {
+			d.Coordinate(queue, schedule)
+			close(done)
+		}()
+
+		env, s, err := cronicle.DecodeEnvelope(<-queue)
+		Expect(err).To(BeNil())
+		Expect(s.RunID).To(Equal("dispatch-run"))
+		Expect(env.Dispatch.Task).To(Equal("a"))
+		Consistently(queue, 50*time.Millisecond).ShouldNot(Receive())
+
+		d.Complete(cronicle.TaskResult{RunID: "dispatch-run", Task: "a", Status: cronicle.StatusSuccess, Outputs: map[string]string{"k": "v"}})
+		dispatched := map[string]*cronicle.TaskDispatch{}
+		for i := 0; i < 2; i++ {
+			var b []byte
+			Eventually(queue).Should(Receive(&b))
+			env, _, err := cronicle.DecodeEnvelope(b)
+			Expect(err).To(BeNil())
+			dispatched[env.Dispatch.Task] = env.Dispatch
+		}
+		Expect(dispatched).To(HaveKey("b"))
+		Expect(dispatched).To(HaveKey("c"))
+		Expect(dispatched["b"].Upstream["a"]["k"]).To(Equal("v"))
+
+		d.Complete(cronicle.TaskResult{RunID: "dispatch-run", Task: "b", Status: cronicle.StatusSuccess})
+		d.Complete(cronicle.TaskResult{RunID: "dispatch-run", Task: "c", Status: cronicle.StatusFailed, Error: "boom"})
+		Eventually(done).Should(BeClosed())
+		Expect(d.InFlight()).To(Equal(0))
+
+		records, err := cronicle.NewHistory(dispatchPath).Query(cronicle.HistoryFilter{Schedule: "foo"})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(1))
+		Expect(records[0].Kind).To(Equal(cronicle.RunKindSchedule))
+		Expect(records[0].Status).To(Equal(cronicle.StatusFailed))
+		Expect(records[0].Error).To(ContainSubstring("boom"))
+	})
+
+	It("Dispatcher.Watch should fail the dispatched tasks of dead workers and lost results", func() {
+		schedule := cronicle.Schedule{Name: "foo", Now: time.Now(), RunID: "watch-run", Dispatch: cronicle.DispatchTask}
+		schedule.Tasks = []cronicle.Task{{Name: "a"}, {Name: "b"}}
+		schedule.PropigateTaskProperties(dispatchPath)
+
+		d := cronicle.NewDispatcher(time.Minute)
+		queue := make(chan []byte, 10)
+		done := make(chan struct{})
+		go func() {
+			d.Coordinate(queue, schedule)
+			close(done)
+		}()
+		Eventually(d.InFlight).Should(Equal(2))
+
+		now := time.Now()
+		running := func(id string, seen time.Time, tasks ...string) cronicle.WorkerStatus {
+			status := cronicle.WorkerStatus{ID: id, LastSeen: seen}
+			for _, task := range tasks {
+				status.Runs = append(status.Runs, cronicle.WorkerRun{RunID: "watch-run", Schedule: "foo", Task: task})
+			}
+			return status
+		}
+		d.Watch([]cronicle.WorkerStatus{running("w1", now, "a"), running("w2", now, "b")}, now)
+		Expect(d.InFlight()).To(Equal(2))
+
+		//w1 stopped heartbeating and w2 no longer lists b without a result
+		later := now.Add(time.Minute)
+		d.Watch([]cronicle.WorkerStatus{running("w1", now, "a"), running("w2", later)}, later)
+		Eventually(done).Should(BeClosed())
+		Expect(d.InFlight()).To(Equal(0))
+
+		records, err := cronicle.NewHistory(dispatchPath).Query(cronicle.HistoryFilter{Schedule: "foo"})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(1))
+		Expect(records[0].Error).To(ContainSubstring("worker w1 executing the task is dead"))
+		Expect(records[0].Error).To(ContainSubstring("worker w2 completed the task without reporting its result"))
+	})
+
+	It("Dispatcher.Watch should fail a dispatched task no worker started within the timeout", func() {
+		schedule := cronicle.Schedule{Name: "foo", Now: time.Now(), RunID: "unclaimed-run", Dispatch: cronicle.DispatchTask}
+		schedule.Tasks = []cronicle.Task{{Name: "a"}}
+		schedule.PropigateTaskProperties(dispatchPath)
+
+		d := cronicle.NewDispatcher(time.Minute)
+		queue := make(chan []byte, 10)
+		done := make(chan struct{})
+		go func() {
+			d.Coordinate(queue, schedule)
+			close(done)
+		}()
+		Eventually(d.InFlight).Should(Equal(1))
+
+		d.Watch(nil, time.Now().Add(30*time.Second))
+		Expect(d.InFlight()).To(Equal(1))
+		d.Watch(nil, time.Now().Add(2*time.Minute))
+		Eventually(done).Should(BeClosed())
+
+		records, err := cronicle.NewHistory(dispatchPath).Query(cronicle.HistoryFilter{Schedule: "foo"})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(1))
+		Expect(records[0].Error).To(ContainSubstring("task was not started by a worker within 1m0s"))
+	})
+
+	It("ConsumeSchedule should execute only the dispatched task instance", func() {
+		schedule := cronicle.Schedule{Name: "foo", Now: time.Now(), RunID: "dispatch-worker-run"}
+		schedule.Tasks = []cronicle.Task{
+			{Name: "bar", ForEach: []string{"x", "y"}, Command: []string{"/bin/echo", "${each.value}"}},
+			{Name: "baz", Command: []string{"/bin/echo", "baz"}},
+		}
+		env := cronicle.NewEnvelope(schedule)
+		env.Dispatch = &cronicle.TaskDispatch{Task: "bar", EachValue: "y"}
+
+		var wg sync.WaitGroup
+		queue := make(chan []byte)
+		go cronicle.ConsumeSchedule(queue, dispatchPath, &wg)
+		queue <- env.JSON()
+		time.Sleep(50 * time.Millisecond)
+		wg.Wait()
+		close(queue)
+
+		records, err := cronicle.NewHistory(dispatchPath).Query(cronicle.HistoryFilter{})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(1))
+		Expect(records[0].Task).To(Equal("bar[y]"))
+		Expect(records[0].RunID).To(Equal("dispatch-worker-run"))
+	})
+
+	It("conf.Validate() should error on an unknown dispatch", func() {
+		conf := cronicle.Default()
+		conf.Schedules[0].Dispatch = cronicle.DispatchTask
+		Expect(conf.Validate()).To(BeNil())
+		conf.Schedules[0].Dispatch = "worker"
+		Expect(conf.Validate()).To(MatchError(ContainSubstring(`dispatch = "worker"`)))
+	})
+})
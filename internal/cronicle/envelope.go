@@ -0,0 +1,140 @@
+package cronicle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//EnvelopeVersion is the schema version of the Envelope produced by this build. Fields added to
+//the Envelope or the Schedule are ignored by older workers, so the version is only bumped for
+//changes that an older worker can not execute correctly.
+const EnvelopeVersion = 1
+
+//DeadLetterQueueSuffix names the queue that rejected messages are sent to, i.e. "cronicle-dead"
+const DeadLetterQueueSuffix = "-dead"
+
+var (
+	//ErrEnvelopeVersion is thrown because a message was produced with an unknown envelope version
+	ErrEnvelopeVersion = errors.New("unknown envelope version")
+	//ErrEnvelopePayload is thrown because a message does not carry a schedule
+	ErrEnvelopePayload = errors.New("envelope has no schedule payload")
+)
+
+//Envelope is the versioned message of a queued schedule run
+type Envelope struct {
+	Version int
+	RunID   string
+	//Producer is the host:pid of the cronicle run process that queued the run
+	Producer string
+	Enqueued time.Time
+	//Commit is the commit of the config repo the schedule was loaded from, if any
+	Commit string
+	//Payload is the json of the Schedule
+	Payload json.RawMessage
+	//Dispatch is the task to execute if only one task of the schedule run is dispatched
+	Dispatch *TaskDispatch `json:",omitempty"`
+	//LastSuccess are the commits of the last successful attempts of the tasks with notify.author,
+	//by task name, from the run history of the producer
+	LastSuccess map[string]string `json:",omitempty"`
+}
+
+//DeadLetter is a message that was rejected by a worker or dropped by the producer,
+//sent to the dead-letter queue with the reason it was rejected.
+type DeadLetter struct {
+	Error  string
+	Worker string
+	Time   time.Time
+	//Message is the rejected message as received
+	Message json.RawMessage
+}
+
+//deadLetterQueue receives the rejected messages of this process, Run and StartWorker
+//set it to the dead-letter queue of the transport in distributed mode.
+var deadLetterQueue chan<- []byte
+
+//NewEnvelope returns the Envelope of a schedule run produced by this process
+func NewEnvelope(schedule Schedule) Envelope {
+	return Envelope{
+		Version:     EnvelopeVersion,
+		RunID:       schedule.RunID,
+		Producer:    workerID,
+		Enqueued:    time.Now(),
+		Commit:      schedule.Commit,
+		Payload:     schedule.JSON(),
+		LastSuccess: schedule.lastSuccessCommits(),
+	}
+}
+
+//JSON method returns a json []byte array of the struct
+func (env Envelope) JSON() []byte {
+	b, err := json.Marshal(&env)
+	if err != nil {
+		log.Error(err)
+	}
+	return b
+}
+
+//DecodeEnvelope decodes a queued message into its Envelope and Schedule. Unknown versions
+//are rejected, unknown fields added by newer producers of the same version are ignored so that
+//a mixed-version cluster can be upgraded. A message without a Version is decoded as the bare
+//Schedule json produced by cronicle before the envelope was introduced.
+func DecodeEnvelope(b []byte) (Envelope, Schedule, error) {
+	var env Envelope
+	var schedule Schedule
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return env, schedule, err
+	}
+
+	if _, ok := fields["Version"]; !ok {
+		if err := json.Unmarshal(b, &schedule); err != nil {
+			return env, schedule, err
+		}
+		if schedule.Name == "" {
+			return env, schedule, ErrScheduleNameEmpty
+		}
+		env = Envelope{RunID: schedule.RunID, Payload: b}
+		return env, schedule, nil
+	}
+
+	if err := json.Unmarshal(b, &env); err != nil {
+		return env, schedule, err
+	}
+	if env.Version != EnvelopeVersion {
+		return env, schedule, fmt.Errorf("%w %d, this worker reads version %d", ErrEnvelopeVersion, env.Version, EnvelopeVersion)
+	}
+	if len(env.Payload) == 0 || string(env.Payload) == "null" {
+		return env, schedule, ErrEnvelopePayload
+	}
+	if err := json.Unmarshal(env.Payload, &schedule); err != nil {
+		return env, schedule, fmt.Errorf("payload: %w", err)
+	}
+	if schedule.Name == "" {
+		return env, schedule, ErrScheduleNameEmpty
+	}
+	schedule.RunID = env.RunID
+	return env, schedule, nil
+}
+
+//deadLetter logs a rejected message and sends it to the dead-letter queue, if there is one
+func deadLetter(b []byte, reason error) {
+	log.WithFields(log.Fields{"cronicle": "dead-letter"}).Error("Rejected message: ", reason)
+	schedulesDeadLettered.Inc()
+	if deadLetterQueue == nil {
+		return
+	}
+	msg := json.RawMessage(b)
+	if !json.Valid(b) {
+		msg, _ = json.Marshal(string(b))
+	}
+	letter, err := json.Marshal(DeadLetter{Error: reason.Error(), Worker: workerID, Time: time.Now(), Message: msg})
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	deadLetterQueue <- letter
+}
@@ -0,0 +1,114 @@
+package cronicle_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Envelope", func() {
+	var schedule cronicle.Schedule
+
+	BeforeEach(func() {
+		schedule = cronicle.Default().Schedules[0]
+		schedule.RunID = "run1"
+		schedule.Now = time.Date(2020, 11, 1, 22, 8, 41, 0, time.UTC)
+	})
+
+	It("cronicle.DecodeEnvelope should decode the schedule of an envelope", func() {
+		env := cronicle.NewEnvelope(schedule)
+		Expect(env.Version).To(Equal(cronicle.EnvelopeVersion))
+		Expect(env.Producer).ToNot(BeEmpty())
+
+		decoded, s, err := cronicle.DecodeEnvelope(env.JSON())
+		Expect(err).To(BeNil())
+		Expect(decoded.RunID).To(Equal("run1"))
+		Expect(s.Name).To(Equal("foo"))
+		Expect(s.RunID).To(Equal("run1"))
+		Expect(s.Now.Equal(schedule.Now)).To(BeTrue())
+	})
+
+	It("cronicle.NewEnvelope should carry the commit the schedule was loaded from", func() {
+		envelopePath, _ := filepath.Abs("./test_envelope/")
+		os.MkdirAll(envelopePath, 0777)
+		defer os.RemoveAll(envelopePath)
+		r, err := git.PlainInit(envelopePath, false)
+		Expect(err).To(BeNil())
+		cronicleFile := filepath.Join(envelopePath, "cronicle.hcl")
+		hcl := "schedule \"foo\" {\n  cron = \"@every 1h\"\n  task \"bar\" {\n    command = [\"/bin/echo\", \"bar\"]\n  }\n}\n"
+		Expect(ioutil.WriteFile(cronicleFile, []byte(hcl), 0644)).To(BeNil())
+		w, _ := r.Worktree()
+		w.Add("cronicle.hcl")
+		h, err := w.Commit("add foo", &git.CommitOptions{Author: &object.Signature{Name: "a", Email: "a@example.com", When: time.Now()}})
+		Expect(err).To(BeNil())
+
+		conf, err := cronicle.GetConfig(cronicleFile)
+		Expect(err).To(BeNil())
+		Expect(conf.Commit).To(Equal(h.String()))
+		env := cronicle.NewEnvelope(conf.Schedules[0])
+		Expect(env.Commit).To(Equal(h.String()))
+		Expect(string(env.Payload)).ToNot(ContainSubstring(h.String()))
+	})
+
+	It("cronicle.DecodeEnvelope should decode a bare schedule from a producer without envelopes", func() {
+		env, s, err := cronicle.DecodeEnvelope(schedule.JSON())
+		Expect(err).To(BeNil())
+		Expect(env.Version).To(Equal(0))
+		Expect(s.Name).To(Equal("foo"))
+		Expect(s.RunID).To(Equal("run1"))
+	})
+
+	It("cronicle.DecodeEnvelope should reject unknown versions and missing payloads", func() {
+		env := cronicle.NewEnvelope(schedule)
+		env.Version = 2
+		_, _, err := cronicle.DecodeEnvelope(env.JSON())
+		Expect(err).To(MatchError(cronicle.ErrEnvelopeVersion))
+
+		_, _, err = cronicle.DecodeEnvelope([]byte(`{"Version":1,"RunID":"run1"}`))
+		Expect(err).To(MatchError(cronicle.ErrEnvelopePayload))
+
+		_, _, err = cronicle.DecodeEnvelope([]byte(`{"Version":1,"Payload":{"Name":"foo","Tasks":"bar"}}`))
+		Expect(err).ToNot(BeNil())
+
+		_, _, err = cronicle.DecodeEnvelope([]byte(`not json`))
+		Expect(err).ToNot(BeNil())
+
+		_, _, err = cronicle.DecodeEnvelope([]byte(`{}`))
+		Expect(err).To(Equal(cronicle.ErrScheduleNameEmpty))
+	})
+
+	It("cronicle.DecodeEnvelope should ignore the fields added by a newer producer of the same version", func() {
+		_, s, err := cronicle.DecodeEnvelope([]byte(`{"Version":1,"RunID":"run1","Extra":true,"Payload":{"Name":"foo","Bogus":1}}`))
+		Expect(err).To(BeNil())
+		Expect(s.Name).To(Equal("foo"))
+		Expect(s.RunID).To(Equal("run1"))
+	})
+
+	It("ConsumeSchedule should not execute a malformed message", func() {
+		path, _ := filepath.Abs("./test_envelope/")
+		os.MkdirAll(path, 0777)
+		defer os.RemoveAll(path)
+
+		var wg sync.WaitGroup
+		queue := make(chan []byte)
+		go cronicle.ConsumeSchedule(queue, path, &wg)
+		b, _ := json.Marshal(map[string]interface{}{"Version": 9, "Payload": schedule})
+		queue <- b
+		queue <- []byte(`{"Name":`)
+		wg.Wait()
+		close(queue)
+
+		records, err := cronicle.NewHistory(path).Query(cronicle.HistoryFilter{})
+		Expect(err).To(BeNil())
+		Expect(records).To(BeEmpty())
+	})
+})
@@ -1,6 +1,11 @@
 package cronicle
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
 	"strings"
 	"time"
 
@@ -14,68 +19,134 @@ import (
 //prior to execution, the command will replace any ${date}, ${datetime}, ${timestamp}
 //with time t given in the bash command
 func (task *Task) Exec(t time.Time) exec.Result {
+	return task.ExecContext(context.Background(), t)
+}
+
+//ExecContext is Exec with a context, the command is killed if ctx is done before it exits
+//or once task.Timeout has elapsed.
+func (task *Task) ExecContext(ctx context.Context, t time.Time) exec.Result {
+	return task.execAttempt(ctx, t, 1)
+}
+
+//execAttempt executes the given attempt of task.Command, streaming each line
+//of stdout and stderr to the log as it is written.
+func (task *Task) execAttempt(ctx context.Context, t time.Time, attempt int) exec.Result {
 	var result exec.Result
-	r := strings.NewReplacer(
+	if task.Timeout != "" {
+		timeout, err := time.ParseDuration(task.Timeout)
+		if err != nil {
+			result.Error = err
+			return result
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	replacements := []string{
 		"${date}", t.Format(TimeArgumentFormatMap["${date}"]),
 		"${datetime}", t.Format(TimeArgumentFormatMap["${datetime}"]),
 		"${timestamp}", t.Format(TimeArgumentFormatMap["${timestamp}"]),
 		"${path}", task.Path,
-	)
+	}
+	if task.eachValue != "" {
+		replacements = append(replacements, EachValueRef, task.eachValue)
+	}
+	for name, outputs := range task.upstream {
+		for key, value := range outputs {
+			replacements = append(replacements, outputRef(name, key), value)
+		}
+	}
+	r := strings.NewReplacer(replacements...)
 	if len(task.Command) > 0 {
 		cmd := make([]string, len(task.Command))
 		for i, s := range task.Command {
 			s = r.Replace(s)
+			if ref := outputRefPattern.FindString(s); ref != "" {
+				result.Command = task.Command
+				result.Error = fmt.Errorf("%s is not an output of a completed upstream task", ref)
+				return result
+			}
 			cmd[i] = s
 		}
 
-		result = exec.Execute(cmd, task.Path, task.Env)
+		//The command writes key=value outputs to the file at $CRONICLE_OUTPUT
+		outputFile, err := ioutil.TempFile("", "cronicle-output-")
+		if err != nil {
+			result.Error = err
+			return result
+		}
+		outputFile.Close()
+		defer os.Remove(outputFile.Name())
+		env := append([]string{OutputEnv + "=" + outputFile.Name()}, task.Env...)
+
+		logger := log.WithFields(log.Fields{
+			"schedule": task.ScheduleName,
+			"task":     task.Name,
+			"attempt":  attempt,
+		})
+		//Keep the output of the attempt at .cronicle/runs/<schedule>/<task>/<time>/<attempt>.log,
+		//the output is also streamed to the log unless it is written to cronicle.log.
+		var runLog io.Writer
+		if task.CroniclePath != "" {
+			f, err := task.openRunLog(t, attempt)
+			if err != nil {
+				logger.Error(err)
+			} else {
+				defer f.Close()
+				runLog = f
+			}
+		}
+		opts := exec.Options{
+			MaxOutput: task.MaxOutput,
+			OnLine: func(stream string, line string) {
+				if runLog == nil || !logToFileGlobal {
+					logger.WithField("stream", stream).Info(line)
+				}
+				if runLog != nil {
+					io.WriteString(runLog, line+"\n")
+				}
+			},
+		}
+		result = exec.ExecuteContext(ctx, cmd, task.Path, env, opts)
+		if result.Error == nil {
+			outputs, err := readOutputs(outputFile.Name())
+			if err != nil {
+				result.Error = err
+				return result
+			}
+			if len(outputs) > 0 {
+				logger.WithField("outputs", outputs).Info("Outputs")
+			}
+			task.outputs = outputs
+		}
 	}
 	return result
 }
 
 // Execute does a git pull, git checkout and exec's the given command
 func (task *Task) Execute(t time.Time) (exec.Result, error) {
+	return task.ExecuteContext(context.Background(), t)
+}
+
+// ExecuteContext is Execute with a context, once ctx is done the running
+// command is killed and no further retry attempts are made.
+func (task *Task) ExecuteContext(ctx context.Context, t time.Time) (exec.Result, error) {
 
 	//Validate the task
 	if err := task.Validate(); err != nil {
 		return exec.Result{}, err
 	}
 
-	//Test if the given task should execute in the root croniclePath and the croncilePath is a git repo
-	taskPathIsCroniclePathWithGit := (task.Path == task.CroniclePath) && task.CronicleRepo != nil
-
-	//If a repo is given, clone the repo and task.Git.Open(task.Path)
-	if task.Repo != nil {
-		auth, err := task.Repo.Auth()
-		if err != nil {
-			return exec.Result{}, err
-		}
-		g, err := Clone(task.Path, task.Repo.URL, &auth)
-		// g, err := Clone(task.Path, task.Repo.URL, task.Repo.DeployKey)
-		if err != nil {
-			return exec.Result{}, err
-		}
-		task.Git = g
-		err = task.Git.Checkout(task.Repo.Branch, task.Repo.Commit)
-		if err != nil {
-			return exec.Result{}, err
-		}
-	} else if taskPathIsCroniclePathWithGit {
-		auth, err := task.CronicleRepo.Auth()
-		if err != nil {
-			return exec.Result{}, err
-		}
-		task.Git, err = Clone(task.CroniclePath, task.CronicleRepo.URL, &auth)
-		// var err error
-		// task.Git, err = Clone(task.CroniclePath, task.CronicleRepo.URL, task.CronicleRepo.DeployKey)
-		if err != nil {
-			log.Error(err)
-			return exec.Result{}, err
-		}
+	start := time.Now()
+	if err := task.checkoutOnce(); err != nil {
+		task.Record(t, 0, start, exec.Result{Error: err})
+		task.SendNotify(EventFailure, t, 0, exec.Result{Error: err})
+		return exec.Result{}, err
 	}
 
 	//Execute task.Command in bash at time t with retry
 	var result exec.Result
+	var lastAttempt int
 	err := try.Do(func(attempt int) (bool, error) {
 
 		log.WithFields(log.Fields{
@@ -86,14 +157,14 @@ func (task *Task) Execute(t time.Time) (exec.Result, error) {
 			"date":     t.Format(time.RFC850),
 		}).Info("Executing...")
 		var err error
-		result = task.Exec(t)
+		start := time.Now()
+		result = task.execAttempt(ctx, t, attempt)
 		err = result.Error
 		task.Log(result)
-		if err != nil && task.Retry != nil {
-			duration := time.Duration(task.Retry.Seconds) * time.Second
-			duration += time.Duration(task.Retry.Minutes) * time.Minute
-			duration += time.Duration(task.Retry.Hours) * time.Hour
-			time.Sleep(duration)
+		task.Record(t, attempt, start, result)
+		lastAttempt = attempt
+		if ctx.Err() != nil {
+			return false, err
 		}
 
 		var retryCount int
@@ -103,17 +174,72 @@ func (task *Task) Execute(t time.Time) (exec.Result, error) {
 		default:
 			retryCount = task.Retry.Count
 		}
+		if err != nil && attempt < retryCount {
+			task.SendNotify(EventRetry, t, attempt, result)
+		}
+
+		if err != nil && task.Retry != nil {
+			duration := time.Duration(task.Retry.Seconds) * time.Second
+			duration += time.Duration(task.Retry.Minutes) * time.Minute
+			duration += time.Duration(task.Retry.Hours) * time.Hour
+			select {
+			case <-time.After(duration):
+			case <-ctx.Done():
+				return false, err
+			}
+		}
 
 		return attempt < retryCount, err
 	})
 	if err != nil {
+		task.SendNotify(EventFailure, t, lastAttempt, result)
 		return result, err
 	}
 
+	task.SendNotify(EventSuccess, t, lastAttempt, result)
 	return result, nil
 }
 
-//Log logs the exit status, stderr, git commit and other logging data.
+//Checkout clones and checks out task.Repo into task.Path, or opens the cronicle
+//repo if the task executes in the root croniclePath, and populates task.Git.
+func (task *Task) Checkout() error {
+	//Test if the given task should execute in the root croniclePath and the croncilePath is a git repo
+	taskPathIsCroniclePathWithGit := (task.Path == task.CroniclePath) && task.CronicleRepo != nil
+
+	//If a repo is given, clone the repo and task.Git.Open(task.Path)
+	if task.Repo != nil {
+		auth, err := task.Repo.Auth()
+		if err != nil {
+			return err
+		}
+		g, err := Clone(task.Path, task.Repo.URL, &auth)
+		// g, err := Clone(task.Path, task.Repo.URL, task.Repo.DeployKey)
+		if err != nil {
+			return err
+		}
+		task.Git = g
+		err = task.Git.Checkout(task.Repo.Branch, task.Repo.Commit)
+		if err != nil {
+			return err
+		}
+	} else if taskPathIsCroniclePathWithGit {
+		auth, err := task.CronicleRepo.Auth()
+		if err != nil {
+			return err
+		}
+		task.Git, err = Clone(task.CroniclePath, task.CronicleRepo.URL, &auth)
+		// var err error
+		// task.Git, err = Clone(task.CroniclePath, task.CronicleRepo.URL, task.CronicleRepo.DeployKey)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+	return nil
+}
+
+//Log logs the exit status, git commit and other logging data,
+//the command output has already been written to the run log by Exec.
 func (task *Task) Log(res exec.Result) {
 
 	var commit string
@@ -133,11 +259,12 @@ func (task *Task) Log(res exec.Result) {
 			"path":     task.Path,
 			"exit":     res.ExitStatus,
 			"error":    res.Error,
+			"timeout":  res.TimedOut,
 			"commit":   commit,
 			"email":    email,
 			"success":  false,
 			"command":  strings.Join(res.Command, " "),
-		}).Error(res.Stderr)
+		}).Error("Failed")
 	} else {
 		log.WithFields(log.Fields{
 			"schedule": task.ScheduleName,
@@ -148,7 +275,7 @@ func (task *Task) Log(res exec.Result) {
 			"email":    email,
 			"success":  true,
 			"command":  strings.Join(res.Command, " "),
-		}).Info(res.Stdout)
+		}).Info("Success")
 	}
 
 }
@@ -1,6 +1,8 @@
 package cronicle_test
 
 import (
+	"os"
+	"path/filepath"
 	"time"
 
 	"fmt"
@@ -199,3 +201,55 @@ var _ = Describe("Exec", func() {
 		}))
 	})
 })
+
+var _ = Describe("Timeout", func() {
+	var timeoutPath string
+
+	BeforeEach(func() {
+		timeoutPath, _ = filepath.Abs("./test_timeout/")
+		os.MkdirAll(timeoutPath, 0777)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(timeoutPath)
+	})
+
+	It("task.Execute should kill a command after task.Timeout and retry it", func() {
+		schedule := cronicle.Default().Schedules[0]
+		schedule.PropigateTaskProperties(timeoutPath)
+		task := schedule.Tasks[0]
+		task.Command = []string{"/bin/sleep", "3"}
+		task.Timeout = "200ms"
+		task.Retry = &cronicle.Retry{Count: 2}
+
+		then := time.Now()
+		t, _ := time.Parse(time.RFC3339, "2020-11-01T22:08:41+00:00")
+		r, err := task.Execute(t)
+		Expect(time.Since(then).Seconds()).To(BeNumerically("<", 2))
+		Expect(err).To(Equal(exec.ErrTimeout))
+		Expect(r.TimedOut).To(BeTrue())
+
+		records, err := cronicle.NewHistory(timeoutPath).Query(cronicle.HistoryFilter{Task: "bar"})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(2))
+		Expect(records[0].Status).To(Equal(cronicle.StatusTimedOut))
+		Expect(records[0].Attempt).To(Equal(2))
+		Expect(records[1].Status).To(Equal(cronicle.StatusTimedOut))
+	})
+
+	It("schedule.PropigateTaskProperties should default task.Timeout to schedule.Timeout", func() {
+		conf := cronicle.Default()
+		conf.Schedules[0].Timeout = "1h"
+		conf.Schedules[0].Tasks = append(conf.Schedules[0].Tasks, cronicle.Task{Name: "baz", Timeout: "5m"})
+		conf.PropigateTaskProperties("./path/")
+		Expect(conf.Schedules[0].Tasks[0].Timeout).To(Equal("1h"))
+		Expect(conf.Schedules[0].Tasks[1].Timeout).To(Equal("5m"))
+	})
+
+	It("conf.Validate() should error on a malformed timeout", func() {
+		conf := cronicle.Default()
+		conf.Schedules[0].Tasks[0].Timeout = "soon"
+		err := conf.Validate()
+		Expect(err).ToNot(BeNil())
+	})
+})
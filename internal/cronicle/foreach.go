@@ -0,0 +1,182 @@
+package cronicle
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform/tfdiags"
+)
+
+//EachValueRef is replaced in the command of a for_each task instance with its value
+const EachValueRef = "${each.value}"
+
+//maxInstanceKey is the max length of the value in the name of a for_each instance
+const maxInstanceKey = 64
+
+//instanceKey returns value if it is a safe run log path and metrics label, otherwise the value
+//with the other characters replaced by "_", truncated and suffixed with a hash of the value.
+func instanceKey(value string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, value)
+	if safe == value && len(value) <= maxInstanceKey && strings.Trim(value, ".") != "" {
+		return value
+	}
+	if len(safe) > maxInstanceKey {
+		safe = safe[:maxInstanceKey]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(value))
+	return fmt.Sprintf("%s-%08x", safe, h.Sum32())
+}
+
+//instance returns the for_each instance of task for the given value, named "<task.Name>[<value>]"
+//with the value made safe by instanceKey
+func (task Task) instance(value string) Task {
+	task.Name = fmt.Sprintf("%s[%s]", task.Name, instanceKey(value))
+	task.ForEach = nil
+	task.eachValue = value
+	return task
+}
+
+//sharedCheckout checks out the repo of the for_each instances of a task once, the instances
+//execute in the same task.Path and would otherwise clone and check it out concurrently.
+type sharedCheckout struct {
+	once sync.Once
+	git  Git
+	err  error
+}
+
+//checkoutOnce checks out the task repo, once for all instances sharing task.checkout
+func (task *Task) checkoutOnce() error {
+	if task.checkout == nil {
+		return task.Checkout()
+	}
+	task.checkout.once.Do(func() {
+		task.checkout.err = task.Checkout()
+		task.checkout.git = task.Git
+	})
+	task.Git = task.checkout.git
+	return task.checkout.err
+}
+
+//dynamicForEach returns true if task.ForEach references the outputs of an upstream task,
+//in which case the instances are only known once the upstream task has completed.
+func (task *Task) dynamicForEach() bool {
+	for _, v := range task.ForEach {
+		if outputRefPattern.MatchString(v) {
+			return true
+		}
+	}
+	return false
+}
+
+//forEachValues resolves task.ForEach with the upstream task outputs. A value that references
+//an output is split on "," so that an upstream task can publish a list, i.e. customers=a,b,c
+//Empty and duplicate values are dropped.
+func (task *Task) forEachValues() ([]string, error) {
+	var replacements []string
+	for name, outputs := range task.upstream {
+		for key, value := range outputs {
+			replacements = append(replacements, outputRef(name, key), value)
+		}
+	}
+	r := strings.NewReplacer(replacements...)
+
+	values := []string{}
+	seen := map[string]bool{}
+	for _, v := range task.ForEach {
+		var items []string
+		if outputRefPattern.MatchString(v) {
+			v = r.Replace(v)
+			if ref := outputRefPattern.FindString(v); ref != "" {
+				return nil, fmt.Errorf("for_each %s is not an output of a completed upstream task", ref)
+			}
+			items = strings.Split(v, ",")
+		} else {
+			items = []string{v}
+		}
+		for _, item := range items {
+			item = strings.TrimSpace(item)
+			if item != "" && !seen[item] {
+				seen[item] = true
+				values = append(values, item)
+			}
+		}
+	}
+	return values, nil
+}
+
+//expandTasks returns schedule.Tasks with each task with a literal for_each list replaced by its
+//instances, tasks that depend on it depend on all of its instances. Tasks with a for_each that
+//references upstream outputs are expanded when they execute.
+func (schedule *Schedule) expandTasks() []Task {
+	instances := map[string][]string{}
+	tasks := []Task{}
+	for _, task := range schedule.Tasks {
+		if task.ForEach == nil || task.dynamicForEach() {
+			tasks = append(tasks, task)
+			continue
+		}
+		values, _ := task.forEachValues()
+		if len(values) == 0 {
+			tasks = append(tasks, task)
+			continue
+		}
+		task.checkout = &sharedCheckout{}
+		for _, v := range values {
+			inst := task.instance(v)
+			tasks = append(tasks, inst)
+			instances[task.Name] = append(instances[task.Name], inst.Name)
+		}
+	}
+
+	for i := range tasks {
+		depends := []string{}
+		for _, dep := range tasks[i].Depends {
+			if names, ok := instances[dep]; ok {
+				depends = append(depends, names...)
+			} else {
+				depends = append(depends, dep)
+			}
+		}
+		if tasks[i].Depends != nil {
+			tasks[i].Depends = depends
+		}
+	}
+	return tasks
+}
+
+//executeInstances executes an instance of task for each value in parallel and waits for all of them,
+//the outputs of each instance are kept in states by instance name.
+func (task *Task) executeInstances(ctx context.Context, t time.Time, values []string, states *taskStates) error {
+	var mu sync.Mutex
+	var diags tfdiags.Diagnostics
+	var wg sync.WaitGroup
+	parent := *task
+	parent.checkout = &sharedCheckout{}
+	for _, v := range values {
+		inst := parent.instance(v)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := inst.execute(ctx, t); err != nil {
+				mu.Lock()
+				diags = diags.Append(fmt.Errorf("%s: %w", inst.Name, err))
+				mu.Unlock()
+				return
+			}
+			states.setOutputs(inst.Name, inst.outputs)
+		}()
+	}
+	wg.Wait()
+	return diags.Err()
+}
@@ -0,0 +1,168 @@
+package cronicle_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ForEach", func() {
+	var forEachPath string
+	var schedule cronicle.Schedule
+	t, _ := time.Parse(time.RFC3339, "2020-11-01T22:08:41+00:00")
+
+	//taskStatuses executes the schedule and returns the recorded status of each task
+	taskStatuses := func() map[string]string {
+		schedule.PropigateTaskProperties(forEachPath)
+		schedule.Now = t
+		schedule.ExecuteTasks()
+		records, err := cronicle.NewHistory(forEachPath).Query(cronicle.HistoryFilter{Schedule: "foo"})
+		Expect(err).To(BeNil())
+		statuses := map[string]string{}
+		for _, rec := range records {
+			if rec.Kind == cronicle.RunKindTask {
+				statuses[rec.Task] = rec.Status
+			}
+		}
+		return statuses
+	}
+
+	//written returns the sorted names of the files written by the extract instances
+	written := func() []string {
+		files, _ := filepath.Glob(filepath.Join(forEachPath, "*.txt"))
+		names := []string{}
+		for _, f := range files {
+			names = append(names, filepath.Base(f))
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	BeforeEach(func() {
+		forEachPath, _ = filepath.Abs("./test_foreach/")
+		os.MkdirAll(forEachPath, 0777)
+		schedule = cronicle.Schedule{Name: "foo"}
+		schedule.Tasks = []cronicle.Task{
+			{Name: "extract", Command: []string{"/bin/bash", "-c", "sleep 1; touch ${each.value}.txt"}, ForEach: []string{"us", "eu"}},
+			{Name: "load", Command: []string{"/bin/bash", "-c", "ls *.txt | wc -l > count"}, Depends: []string{"extract"}},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(forEachPath)
+	})
+
+	It("cronicle.ParseFile should carry ${each.value} through as a string", func() {
+		cronicleFile := filepath.Join(forEachPath, "cronicle.hcl")
+		hcl := `schedule "foo" {
+  task "extract" {
+    command  = ["/bin/echo", "${each.value}"]
+    for_each = ["us", "eu"]
+  }
+}
+`
+		Expect(ioutil.WriteFile(cronicleFile, []byte(hcl), 0644)).To(BeNil())
+		conf, diags := cronicle.ParseFile(cronicleFile, hclparse.NewParser())
+		Expect(diags.HasErrors()).To(BeFalse())
+		Expect(conf.Schedules[0].Tasks[0].Command).To(Equal([]string{"/bin/echo", "${each.value}"}))
+	})
+
+	It("schedule.ExecuteTasks should execute literal for_each instances in parallel before their dependents", func() {
+		then := time.Now()
+		statuses := taskStatuses()
+		Expect(time.Since(then).Seconds()).To(BeNumerically("<", 2))
+		Expect(written()).To(Equal([]string{"eu.txt", "us.txt"}))
+		Expect(statuses["extract[us]"]).To(Equal(cronicle.StatusSuccess))
+		Expect(statuses["extract[eu]"]).To(Equal(cronicle.StatusSuccess))
+		Expect(statuses["load"]).To(Equal(cronicle.StatusSuccess))
+		b, _ := ioutil.ReadFile(filepath.Join(forEachPath, "count"))
+		Expect(string(b)).To(ContainSubstring("2"))
+	})
+
+	It("schedule.ExecuteTasks should skip dependents if an instance fails", func() {
+		schedule.Tasks[0].Command = []string{"/bin/bash", "-c", "test ${each.value} = us"}
+		statuses := taskStatuses()
+		Expect(statuses["extract[us]"]).To(Equal(cronicle.StatusSuccess))
+		Expect(statuses["extract[eu]"]).To(Equal(cronicle.StatusFailed))
+		Expect(statuses["load"]).To(Equal(cronicle.StatusSkipped))
+	})
+
+	It("schedule.ExecuteTasks should expand a for_each list from an upstream output", func() {
+		schedule.Tasks = append([]cronicle.Task{
+			{Name: "list", Command: []string{"/bin/bash", "-c", "echo regions=us,eu,ap >> $CRONICLE_OUTPUT"}},
+		}, schedule.Tasks...)
+		schedule.Tasks[1].ForEach = []string{"${task.list.regions}"}
+		schedule.Tasks[1].Depends = []string{"list"}
+		statuses := taskStatuses()
+		Expect(written()).To(Equal([]string{"ap.txt", "eu.txt", "us.txt"}))
+		Expect(statuses["extract[ap]"]).To(Equal(cronicle.StatusSuccess))
+		Expect(statuses["load"]).To(Equal(cronicle.StatusSuccess))
+	})
+
+	It("schedule.ExecuteTasks should name the instances of unsafe values after a safe key", func() {
+		schedule.Tasks[0].ForEach = []string{"../a b"}
+		schedule.Tasks[0].Command = []string{"/bin/echo", "${each.value}"}
+		statuses := taskStatuses()
+		Expect(statuses).To(HaveLen(2))
+		for name, status := range statuses {
+			if name != "load" {
+				Expect(name).To(MatchRegexp(`^extract\[\.\._a_b-[0-9a-f]{8}\]$`))
+				Expect(status).To(Equal(cronicle.StatusSuccess))
+			}
+		}
+		runs, _ := filepath.Glob(filepath.Join(forEachPath, ".cronicle", "runs", "foo", "*"))
+		Expect(len(runs)).To(Equal(2))
+	})
+
+	It("schedule.ExecuteTasks should check out the repo of the instances once", func() {
+		srcPath := filepath.Join(forEachPath, "src")
+		os.MkdirAll(srcPath, 0777)
+		r, err := git.PlainInit(srcPath, false)
+		Expect(err).To(BeNil())
+		w, _ := r.Worktree()
+		Expect(ioutil.WriteFile(filepath.Join(srcPath, "README"), []byte("src"), 0644)).To(BeNil())
+		w.Add("README")
+		hash, err := w.Commit("init", &git.CommitOptions{Author: &object.Signature{Name: "a", Email: "a@example.com", When: time.Now()}})
+		Expect(err).To(BeNil())
+
+		schedule.Tasks[0].ForEach = []string{"a", "b", "c", "d", "e", "f"}
+		schedule.Tasks[0].Command = []string{"/bin/bash", "-c", "test -f README"}
+		schedule.Tasks[0].Repo = &cronicle.Repo{URL: srcPath}
+		schedule.Tasks = schedule.Tasks[:1]
+		statuses := taskStatuses()
+		Expect(statuses).To(HaveLen(6))
+		for _, status := range statuses {
+			Expect(status).To(Equal(cronicle.StatusSuccess))
+		}
+		records, err := cronicle.NewHistory(forEachPath).Query(cronicle.HistoryFilter{Schedule: "foo"})
+		Expect(err).To(BeNil())
+		for _, rec := range records {
+			if rec.Kind == cronicle.RunKindTask {
+				Expect(rec.Commit).To(Equal(hash.String()))
+			}
+		}
+	})
+
+	It("schedule.ExecuteTasks should skip a for_each task with an empty list", func() {
+		schedule.Tasks[0].ForEach = []string{}
+		statuses := taskStatuses()
+		Expect(statuses["extract"]).To(Equal(cronicle.StatusSkipped))
+		Expect(statuses["load"]).To(Equal(cronicle.StatusSkipped))
+	})
+
+	It("conf.Validate() should error on ${each.value} without for_each", func() {
+		conf := cronicle.Config{Schedules: []cronicle.Schedule{schedule}}
+		Expect(conf.Validate()).To(BeNil())
+		conf.Schedules[0].Tasks[0].ForEach = nil
+		Expect(conf.Validate()).ToNot(BeNil())
+	})
+})
@@ -120,7 +120,9 @@ func Clone(worktreeDir string, url string, auth *transport.AuthMethod) (Git, err
 
 		cloneOptions := git.CloneOptions{URL: url, Auth: *auth}
 
+		start := time.Now()
 		_, err := git.PlainClone(worktreeDir, false, &cloneOptions)
+		observeGit("clone", start)
 		if err != nil {
 			return Git{}, err
 		}
@@ -163,7 +165,9 @@ func (g *Git) Checkout(branch string, commit string) error {
 		}
 	}
 
+	start := time.Now()
 	err := g.Repository.Fetch(&fetchOptions)
+	observeGit("fetch", start)
 	if err != nil {
 		switch err {
 		case git.NoErrAlreadyUpToDate:
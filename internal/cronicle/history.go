@@ -0,0 +1,346 @@
+package cronicle
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jshiv/cronicle/pkg/exec"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	//RunKindSchedule marks a RunRecord for a whole schedule run
+	RunKindSchedule = "schedule"
+	//RunKindTask marks a RunRecord for a single task attempt
+	RunKindTask = "task"
+
+	//StatusSuccess is the status of a run that exited 0
+	StatusSuccess = "success"
+	//StatusFailed is the status of a run that returned an error
+	StatusFailed = "failed"
+	//StatusSkipped is the status of a run that did not execute
+	StatusSkipped = "skipped"
+	//StatusTimedOut is the status of a task attempt that was killed after task.Timeout
+	StatusTimedOut = "timeout"
+)
+
+var (
+	runsBucket      = []byte("runs")
+	schedulesBucket = []byte("schedules")
+)
+
+//historyMu serializes access to the history db within a process, bolt holds
+//an exclusive file lock for the lifetime of an open db.
+var historyMu sync.Mutex
+
+// RunRecord is a single schedule run or task attempt kept in the run history.
+type RunRecord struct {
+	ID   uint64
+	Kind string
+	//Schedule and Task name the run, Task is empty for schedule runs
+	Schedule string
+	Task     string
+	//Scheduled is the execution time of the run, i.e. Schedule.Now
+	Scheduled time.Time
+	Start     time.Time
+	End       time.Time
+	Status    string
+	//Attempt is the retry attempt of a task, starting at 1.
+	//Attempt 0 records a failure to prepare the task repo before any command ran.
+	Attempt    int
+	ExitStatus int
+	Error      string
+	Commit     string
+	//RunID identifies the schedule run and Worker the process that executed it
+	RunID  string
+	Worker string
+}
+
+//HistoryFilter narrows the records returned by History.Query,
+//zero values are intrepreted as no filtering requested.
+type HistoryFilter struct {
+	Schedule string
+	Task     string
+	Status   string
+	//Since and Until bound the scheduled time of a record
+	Since time.Time
+	Until time.Time
+	//Limit caps the number of records returned, newest first
+	Limit int
+}
+
+// History is the embedded run history store at croniclePath/.cronicle/history.db
+// The db is opened for each operation so that `cronicle history` can read
+// the store while `cronicle run` is writing to it.
+type History struct {
+	Path string
+}
+
+//NewHistory returns the History store for the given croniclePath
+func NewHistory(croniclePath string) *History {
+	return &History{Path: filepath.Join(croniclePath, ".cronicle", "history.db")}
+}
+
+//open opens the bolt db at h.Path, waiting on any other process holding the lock
+func (h *History) open(readOnly bool) (*bolt.DB, error) {
+	if !readOnly {
+		if err := os.MkdirAll(filepath.Dir(h.Path), 0777); err != nil {
+			return nil, err
+		}
+	}
+	return bolt.Open(h.Path, 0644, &bolt.Options{Timeout: 10 * time.Second, ReadOnly: readOnly})
+}
+
+//update runs fn in a read-write transaction
+func (h *History) update(fn func(tx *bolt.Tx) error) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	db, err := h.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(fn)
+}
+
+//view runs fn in a read-only transaction, a missing db is treated as empty
+func (h *History) view(fn func(tx *bolt.Tx) error) error {
+	if !fileExists(h.Path) {
+		return nil
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	db, err := h.open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(fn)
+}
+
+//Record appends rec to the run history and assigns rec.ID
+func (h *History) Record(rec *RunRecord) error {
+	return h.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(runsBucket)
+		if err != nil {
+			return err
+		}
+		id, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		rec.ID = id
+		v, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(id), v)
+	})
+}
+
+//Query returns the records matching filter, newest first
+func (h *History) Query(filter HistoryFilter) ([]RunRecord, error) {
+	records := []RunRecord{}
+	err := h.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(runsBucket)
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var rec RunRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			if !filter.Match(rec) {
+				continue
+			}
+			records = append(records, rec)
+			if filter.Limit > 0 && len(records) >= filter.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+//LastFire returns the last time the named schedule was queued,
+//the zero time is returned if it has never been recorded.
+func (h *History) LastFire(scheduleName string) (time.Time, error) {
+	var last time.Time
+	err := h.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(schedulesBucket)
+		if b == nil {
+			return nil
+		}
+		v := b.Get([]byte(scheduleName))
+		if v == nil {
+			return nil
+		}
+		return last.UnmarshalText(v)
+	})
+	return last, err
+}
+
+//SetLastFire persists t as the last time the named schedule was queued
+func (h *History) SetLastFire(scheduleName string, t time.Time) error {
+	return h.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(schedulesBucket)
+		if err != nil {
+			return err
+		}
+		v, err := t.MarshalText()
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(scheduleName), v)
+	})
+}
+
+//Match reports whether rec satisfies the filter
+func (filter HistoryFilter) Match(rec RunRecord) bool {
+	switch {
+	case filter.Schedule != "" && filter.Schedule != rec.Schedule:
+		return false
+	case filter.Task != "" && filter.Task != rec.Task:
+		return false
+	case filter.Status != "" && filter.Status != rec.Status:
+		return false
+	case !filter.Since.IsZero() && rec.Scheduled.Before(filter.Since):
+		return false
+	case !filter.Until.IsZero() && rec.Scheduled.After(filter.Until):
+		return false
+	}
+	return true
+}
+
+//itob returns an 8-byte big endian representation of v, which keeps bolt keys in insert order
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+//Record reports the outcome of a task attempt to be stored in the run history at task.CroniclePath.
+func (task *Task) Record(t time.Time, attempt int, start time.Time, res exec.Result) {
+	rec := RunRecord{
+		Kind:       RunKindTask,
+		Schedule:   task.ScheduleName,
+		Task:       task.Name,
+		Scheduled:  t,
+		Start:      start,
+		End:        time.Now(),
+		Status:     StatusSuccess,
+		Attempt:    attempt,
+		ExitStatus: res.ExitStatus,
+		RunID:      task.runID,
+		Worker:     workerID,
+	}
+	if res.Error != nil {
+		rec.Status = StatusFailed
+		rec.Error = res.Error.Error()
+	}
+	if res.TimedOut {
+		rec.Status = StatusTimedOut
+	}
+	if task.Git.Commit != nil {
+		rec.Commit = task.Git.Commit.Hash.String()
+	}
+	report(RunResult{CroniclePath: task.CroniclePath, Record: &rec})
+}
+
+//RecordSkipped reports a task run that was not executed because task.TriggerRule was not met.
+func (task *Task) RecordSkipped(t time.Time, reason string) {
+	now := time.Now()
+	rec := RunRecord{
+		Kind:      RunKindTask,
+		Schedule:  task.ScheduleName,
+		Task:      task.Name,
+		Scheduled: t,
+		Start:     now,
+		End:       now,
+		Status:    StatusSkipped,
+		Error:     reason,
+		RunID:     task.runID,
+		Worker:    workerID,
+	}
+	report(RunResult{CroniclePath: task.CroniclePath, Record: &rec})
+}
+
+//Record reports the outcome of a schedule run in the run history at schedule.CroniclePath.
+func (schedule *Schedule) Record(start time.Time, err error) {
+	if err != nil {
+		schedule.RecordStatus(start, StatusFailed, err)
+	} else {
+		schedule.RecordStatus(start, StatusSuccess, nil)
+	}
+}
+
+//RecordStatus reports a schedule run with the given status to be stored in the run history at schedule.CroniclePath.
+func (schedule *Schedule) RecordStatus(start time.Time, status string, err error) {
+	rec := RunRecord{
+		Kind:      RunKindSchedule,
+		Schedule:  schedule.Name,
+		Scheduled: schedule.Now,
+		Start:     start,
+		End:       time.Now(),
+		Status:    status,
+		RunID:     schedule.RunID,
+		Worker:    workerID,
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	report(RunResult{CroniclePath: schedule.CroniclePath, Record: &rec})
+}
+
+//PrintHistory queries the run history kept next to cronicleFile and writes
+//the records to w as a table or as json.
+func PrintHistory(w io.Writer, cronicleFile string, filter HistoryFilter, format string) error {
+	cronicleFileAbs, err := filepath.Abs(cronicleFile)
+	if err != nil {
+		return err
+	}
+	records, err := NewHistory(filepath.Dir(cronicleFileAbs)).Query(filter)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "SCHEDULED\tKIND\tSCHEDULE\tTASK\tATTEMPT\tSTATUS\tEXIT\tDURATION\tCOMMIT")
+		for _, rec := range records {
+			commit := rec.Commit
+			if len(commit) > 11 {
+				commit = commit[:11]
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%d\t%s\t%s\n",
+				rec.Scheduled.Format(time.RFC3339),
+				rec.Kind,
+				rec.Schedule,
+				rec.Task,
+				rec.Attempt,
+				rec.Status,
+				rec.ExitStatus,
+				rec.End.Sub(rec.Start).Round(time.Millisecond),
+				commit,
+			)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q, options are table and json", format)
+	}
+}
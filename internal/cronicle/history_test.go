@@ -0,0 +1,133 @@
+package cronicle_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	"github.com/jshiv/cronicle/pkg/exec"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("History", func() {
+	var historyPath string
+	var history *cronicle.History
+	t, _ := time.Parse(time.RFC3339, "2020-11-01T22:08:41+00:00")
+
+	BeforeEach(func() {
+		historyPath, _ = filepath.Abs("./test_history/")
+		os.MkdirAll(historyPath, 0777)
+		history = cronicle.NewHistory(historyPath)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(historyPath)
+	})
+
+	It("history.Query should return no records if the store does not exist", func() {
+		records, err := history.Query(cronicle.HistoryFilter{})
+		Expect(err).To(BeNil())
+		Expect(records).To(BeEmpty())
+	})
+
+	It("history.Record should assign ids and history.Query should return the newest first", func() {
+		first := cronicle.RunRecord{Kind: cronicle.RunKindTask, Schedule: "foo", Task: "bar", Scheduled: t, Status: cronicle.StatusSuccess}
+		second := cronicle.RunRecord{Kind: cronicle.RunKindTask, Schedule: "foo", Task: "bar", Scheduled: t.Add(time.Hour), Status: cronicle.StatusFailed}
+		Expect(history.Record(&first)).To(BeNil())
+		Expect(history.Record(&second)).To(BeNil())
+		Expect(first.ID).To(Equal(uint64(1)))
+		Expect(second.ID).To(Equal(uint64(2)))
+
+		records, err := history.Query(cronicle.HistoryFilter{})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(2))
+		Expect(records[0].ID).To(Equal(uint64(2)))
+		Expect(records[1].ID).To(Equal(uint64(1)))
+	})
+
+	It("history.Query should filter by schedule, task, status, time range and limit", func() {
+		for i := 0; i < 4; i++ {
+			rec := cronicle.RunRecord{Kind: cronicle.RunKindTask, Schedule: "foo", Task: "bar", Scheduled: t.Add(time.Duration(i) * time.Hour), Status: cronicle.StatusSuccess}
+			if i%2 == 1 {
+				rec.Status = cronicle.StatusFailed
+			}
+			Expect(history.Record(&rec)).To(BeNil())
+		}
+		other := cronicle.RunRecord{Kind: cronicle.RunKindSchedule, Schedule: "baz", Scheduled: t, Status: cronicle.StatusSuccess}
+		Expect(history.Record(&other)).To(BeNil())
+
+		records, _ := history.Query(cronicle.HistoryFilter{Schedule: "baz"})
+		Expect(len(records)).To(Equal(1))
+
+		records, _ = history.Query(cronicle.HistoryFilter{Task: "bar", Status: cronicle.StatusFailed})
+		Expect(len(records)).To(Equal(2))
+
+		records, _ = history.Query(cronicle.HistoryFilter{Task: "bar", Since: t.Add(time.Hour), Until: t.Add(2 * time.Hour)})
+		Expect(len(records)).To(Equal(2))
+
+		records, _ = history.Query(cronicle.HistoryFilter{Limit: 3})
+		Expect(len(records)).To(Equal(3))
+	})
+
+	It("task.Record should store the task attempt under task.CroniclePath", func() {
+		task := cronicle.Task{Name: "bar", ScheduleName: "foo", CroniclePath: historyPath}
+		task.Record(t, 2, t, exec.Result{ExitStatus: 1, Error: errors.New("boom")})
+
+		records, err := history.Query(cronicle.HistoryFilter{})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(1))
+		Expect(records[0].Kind).To(Equal(cronicle.RunKindTask))
+		Expect(records[0].Schedule).To(Equal("foo"))
+		Expect(records[0].Task).To(Equal("bar"))
+		Expect(records[0].Attempt).To(Equal(2))
+		Expect(records[0].Status).To(Equal(cronicle.StatusFailed))
+		Expect(records[0].ExitStatus).To(Equal(1))
+		Expect(records[0].Error).To(Equal("boom"))
+		Expect(records[0].Scheduled.Equal(t)).To(BeTrue())
+	})
+
+	It("schedule.ExecuteTasks should record the schedule run and each task attempt", func() {
+		schedule := cronicle.Default().Schedules[0]
+		schedule.Now = t
+		schedule.PropigateTaskProperties(historyPath)
+		schedule.ExecuteTasks()
+
+		records, err := history.Query(cronicle.HistoryFilter{Schedule: "foo"})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(2))
+		Expect(records[0].Kind).To(Equal(cronicle.RunKindSchedule))
+		Expect(records[0].Status).To(Equal(cronicle.StatusSuccess))
+		Expect(records[1].Kind).To(Equal(cronicle.RunKindTask))
+		Expect(records[1].Attempt).To(Equal(1))
+	})
+
+	It("cronicle.PrintHistory should write json records", func() {
+		rec := cronicle.RunRecord{Kind: cronicle.RunKindTask, Schedule: "foo", Task: "bar", Scheduled: t, Status: cronicle.StatusSuccess}
+		Expect(history.Record(&rec)).To(BeNil())
+
+		var b bytes.Buffer
+		err := cronicle.PrintHistory(&b, filepath.Join(historyPath, "cronicle.hcl"), cronicle.HistoryFilter{}, "json")
+		Expect(err).To(BeNil())
+		var records []cronicle.RunRecord
+		Expect(json.Unmarshal(b.Bytes(), &records)).To(BeNil())
+		Expect(len(records)).To(Equal(1))
+		Expect(records[0].Task).To(Equal("bar"))
+	})
+
+	It("cronicle.PrintHistory should write a table", func() {
+		rec := cronicle.RunRecord{Kind: cronicle.RunKindTask, Schedule: "foo", Task: "bar", Scheduled: t, Status: cronicle.StatusSuccess}
+		Expect(history.Record(&rec)).To(BeNil())
+
+		var b bytes.Buffer
+		err := cronicle.PrintHistory(&b, filepath.Join(historyPath, "cronicle.hcl"), cronicle.HistoryFilter{}, "table")
+		Expect(err).To(BeNil())
+		Expect(b.String()).To(ContainSubstring("SCHEDULED"))
+		Expect(b.String()).To(ContainSubstring("2020-11-01T22:08:41Z"))
+		Expect(b.String()).To(ContainSubstring("success"))
+	})
+})
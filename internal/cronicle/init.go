@@ -190,6 +190,15 @@ func GetConfig(cronicleFile string) (*Config, error) {
 	}
 	// conf.PropigateTaskProperties(croniclePath)
 
+	//The commit the schedules were loaded from is queued with each of their runs
+	var g Git
+	if err := g.Open(croniclePath); err == nil && g.Commit != nil {
+		conf.Commit = g.Commit.Hash.String()
+	}
+	for i := range conf.Schedules {
+		conf.Schedules[i].Commit = conf.Commit
+	}
+
 	// if err := SetConfig(&conf, croniclePath); err != nil {
 	// 	return &conf, err
 	// }
@@ -0,0 +1,121 @@
+package cronicle
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+//Prometheus metrics of the scheduler and workers, served by ServeMetrics at /metrics
+var (
+	schedulesQueued = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cronicle_schedules_queued_total",
+		Help: "Number of schedule runs produced to the queue.",
+	}, []string{"schedule"})
+	tasksDispatched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cronicle_tasks_dispatched_total",
+		Help: "Number of tasks produced to the queue on their own by schedules with dispatch = \"task\".",
+	}, []string{"schedule", "task"})
+	schedulesConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cronicle_schedules_consumed_total",
+		Help: "Number of schedule runs consumed from the queue for execution.",
+	}, []string{"schedule"})
+	schedulesRedelivered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cronicle_schedules_redelivered_total",
+		Help: "Number of schedule runs produced again after no worker acked them within the visibility timeout.",
+	}, []string{"schedule"})
+	schedulesDeadLettered = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cronicle_schedules_dead_lettered_total",
+		Help: "Number of queued messages rejected by a worker or dropped after the max deliveries.",
+	})
+	workerRunsInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cronicle_worker_runs_in_flight",
+		Help: "Number of schedule runs and dispatched tasks the worker is executing.",
+	})
+	taskAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cronicle_task_attempts_total",
+		Help: "Number of task command attempts, including retries.",
+	}, []string{"schedule", "task"})
+	taskRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cronicle_task_retries_total",
+		Help: "Number of task command attempts after the first attempt.",
+	}, []string{"schedule", "task"})
+	taskSuccess = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cronicle_task_success_total",
+		Help: "Number of successful task attempts.",
+	}, []string{"schedule", "task"})
+	taskFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cronicle_task_failures_total",
+		Help: "Number of failed task attempts, including timeouts and repo checkout failures.",
+	}, []string{"schedule", "task"})
+	taskDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cronicle_task_duration_seconds",
+		Help:    "Duration of task command attempts.",
+		Buckets: []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 7200, 14400},
+	}, []string{"schedule", "task"})
+	gitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cronicle_git_duration_seconds",
+		Help:    "Duration of git clone and fetch operations.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+	heartbeatReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cronicle_heartbeat_reloads_total",
+		Help: "Number of heartbeat config loads by result [unchanged, reloaded, error].",
+	}, []string{"result"})
+	configValid = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cronicle_config_valid",
+		Help: "1 if the last heartbeat load of cronicle.hcl was valid, 0 if it was rejected and the last valid config is kept.",
+	})
+	scheduleLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cronicle_schedule_last_success_timestamp_seconds",
+		Help: "Unix time of the last schedule run in which all tasks succeeded.",
+	}, []string{"schedule"})
+	taskLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cronicle_task_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful task attempt.",
+	}, []string{"schedule", "task"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		schedulesQueued,
+		tasksDispatched,
+		schedulesConsumed,
+		schedulesRedelivered,
+		schedulesDeadLettered,
+		workerRunsInFlight,
+		taskAttempts,
+		taskRetries,
+		taskSuccess,
+		taskFailures,
+		taskDuration,
+		gitDuration,
+		heartbeatReloads,
+		configValid,
+		scheduleLastSuccess,
+		taskLastSuccess,
+	)
+}
+
+//observeGit records the duration of a git operation [clone, fetch] that started at start
+func observeGit(operation string, start time.Time) {
+	gitDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+//MetricsHandler returns the http.Handler serving the prometheus metrics at /metrics
+func MetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
+
+//ServeMetrics serves the prometheus metrics at addr/metrics, i.e. ":9090"
+func ServeMetrics(addr string) {
+	log.WithFields(log.Fields{"cronicle": "metrics", "addr": addr}).Info("Starting metrics...")
+	if err := http.ListenAndServe(addr, MetricsHandler()); err != nil {
+		log.WithFields(log.Fields{"cronicle": "metrics", "addr": addr}).Error(err)
+	}
+}
@@ -0,0 +1,83 @@
+package cronicle_test
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metrics", func() {
+	var metricsPath string
+
+	scrape := func() string {
+		w := httptest.NewRecorder()
+		cronicle.MetricsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		return w.Body.String()
+	}
+
+	BeforeEach(func() {
+		metricsPath, _ = filepath.Abs("./test_metrics/")
+		os.MkdirAll(metricsPath, 0777)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(metricsPath)
+	})
+
+	It("task.Execute should count attempts, retries, failures and task duration", func() {
+		schedule := cronicle.Schedule{Name: "metrics"}
+		schedule.Tasks = []cronicle.Task{{Name: "fail", Command: []string{"/bin/bash", "-c", "exit 1"}, Retry: &cronicle.Retry{Count: 2}}}
+		schedule.PropigateTaskProperties(metricsPath)
+		schedule.Tasks[0].Execute(time.Now())
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`cronicle_task_attempts_total{schedule="metrics",task="fail"} 2`))
+		Expect(body).To(ContainSubstring(`cronicle_task_retries_total{schedule="metrics",task="fail"} 1`))
+		Expect(body).To(ContainSubstring(`cronicle_task_failures_total{schedule="metrics",task="fail"} 2`))
+		Expect(body).To(ContainSubstring(`cronicle_task_duration_seconds_count{schedule="metrics",task="fail"} 2`))
+	})
+
+	It("ProduceSchedule and ConsumeSchedule should count queued and consumed schedules and the last success", func() {
+		schedule := cronicle.Schedule{Name: "metrics-queue"}
+		schedule.Tasks = []cronicle.Task{{Name: "ok", Command: []string{"/bin/echo", "ok"}}}
+		var wg sync.WaitGroup
+		queue := make(chan []byte)
+		go cronicle.ConsumeSchedule(queue, metricsPath, &wg)
+		cronicle.ProduceSchedule(schedule, queue)()
+		close(queue)
+		time.Sleep(100 * time.Millisecond)
+		wg.Wait()
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`cronicle_schedules_queued_total{schedule="metrics-queue"} 1`))
+		Expect(body).To(ContainSubstring(`cronicle_schedules_consumed_total{schedule="metrics-queue"} 1`))
+		Expect(body).To(ContainSubstring(`cronicle_task_success_total{schedule="metrics-queue",task="ok"} 1`))
+		Expect(body).To(MatchRegexp(`cronicle_schedule_last_success_timestamp_seconds{schedule="metrics-queue"} \d`))
+		Expect(body).To(MatchRegexp(`cronicle_task_last_success_timestamp_seconds{schedule="metrics-queue",task="ok"} \d`))
+	})
+
+	It("QueueReporter.Report should count the attempts of a worker before publishing them", func() {
+		queue := make(chan []byte, 1)
+		now := time.Now()
+		cronicle.QueueReporter{Queue: queue}.Report(cronicle.RunResult{Record: &cronicle.RunRecord{
+			Kind:     cronicle.RunKindTask,
+			Schedule: "metrics-worker",
+			Task:     "ok",
+			Start:    now,
+			End:      now,
+			Status:   cronicle.StatusSuccess,
+			Attempt:  1,
+		}})
+		Expect(len(queue)).To(Equal(1))
+
+		body := scrape()
+		Expect(body).To(ContainSubstring(`cronicle_task_attempts_total{schedule="metrics-worker",task="ok"} 1`))
+		Expect(body).To(ContainSubstring(`cronicle_task_success_total{schedule="metrics-worker",task="ok"} 1`))
+	})
+})
@@ -0,0 +1,415 @@
+package cronicle
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jshiv/cronicle/pkg/exec"
+)
+
+//Notification events
+const (
+	EventFailure = "failure"
+	EventSuccess = "success"
+	EventRetry   = "retry"
+	//EventConfigRejected is notified to the config level on_failure targets
+	//when a heartbeat reload of cronicle.hcl is rejected
+	EventConfigRejected = "config_rejected"
+)
+
+//Notification target types
+const (
+	TargetWebhook = "webhook"
+	TargetSlack   = "slack"
+	TargetEmail   = "email"
+)
+
+//notifyStderrLines is the number of trailing stderr lines included in a notification
+const notifyStderrLines = 20
+
+// Notify is the structure that defines the notification targets of task events.
+// A notify block given at the config level is inherited by schedules and tasks
+// that do not give their own.
+type Notify struct {
+	// OnFailure targets are notified when a task fails its last attempt
+	OnFailure []Target `hcl:"on_failure,block"`
+	// OnSuccess targets are notified when a task succeeds
+	OnSuccess []Target `hcl:"on_success,block"`
+	// OnRetry targets are notified when a failed task attempt will be retried
+	OnRetry []Target `hcl:"on_retry,block"`
+	// Author opts in to notify the authors of the commits since the last successful run
+	// when a task fails on a new commit. The failure notification lists the commits and
+	// the authors are added to the recipients of the on_failure email targets.
+	Author bool `hcl:"author,optional"`
+}
+
+// Target is a notification target, the label gives the type [webhook, slack, email]
+type Target struct {
+	Type string `hcl:"type,label"`
+	// URL is the endpoint of a webhook, which receives the Notification json,
+	// or of a slack incoming webhook
+	URL string `hcl:"url,optional"`
+	// To, From and SMTP host:port are the email recipients, sender and mail server
+	To   []string `hcl:"to,optional"`
+	From string   `hcl:"from,optional"`
+	SMTP string   `hcl:"smtp,optional"`
+	// Username and Password authenticate with the SMTP server, PasswordEnv names
+	// an environment variable holding the password to keep it out of cronicle.hcl.
+	// The Password is never sent over the queue, notifications are sent by cronicle run.
+	Username    string `hcl:"username,optional"`
+	Password    string `hcl:"password,optional" json:"-"`
+	PasswordEnv string `hcl:"password_env,optional"`
+}
+
+//Notification is the message sent to notify targets of a task event
+type Notification struct {
+	Event      string
+	Schedule   string
+	Task       string
+	Scheduled  time.Time
+	Attempt    int
+	ExitStatus int
+	Error      string
+	TimedOut   bool
+	Stderr     string
+	Commit     string
+	Author     string
+	//LastSuccessCommit and Commits are given for a failure on a new commit if notify.Author is set,
+	//Commits lists the commits since the last successful run, newest first.
+	LastSuccessCommit string       `json:",omitempty"`
+	Commits           []CommitInfo `json:",omitempty"`
+	//Authors are the emails of the authors of Commits to notify, which email targets add to
+	//the recipients and webhook and slack targets receive in the notification
+	Authors []string `json:",omitempty"`
+}
+
+//Validate checks that each target has the fields its type requires
+func (notify *Notify) Validate() error {
+	for _, event := range []string{EventFailure, EventSuccess, EventRetry} {
+		for _, target := range notify.targets(event) {
+			switch target.Type {
+			case TargetWebhook, TargetSlack:
+				if target.URL == "" {
+					return fmt.Errorf(`notify {} on_%s "%s" {} url is required`, event, target.Type)
+				}
+			case TargetEmail:
+				if len(target.To) == 0 || target.From == "" || target.SMTP == "" {
+					return fmt.Errorf(`notify {} on_%s "%s" {} to, from and smtp are required`, event, target.Type)
+				}
+			default:
+				return fmt.Errorf(`notify {} on_%s "%s" {} is not one of webhook, slack or email`, event, target.Type)
+			}
+		}
+	}
+	return nil
+}
+
+//targets returns the targets of the given event
+func (notify *Notify) targets(event string) []Target {
+	switch event {
+	case EventFailure:
+		return notify.OnFailure
+	case EventSuccess:
+		return notify.OnSuccess
+	case EventRetry:
+		return notify.OnRetry
+	}
+	return nil
+}
+
+//SendNotify reports the notification of a task event with the result of the given attempt
+//to be sent to the task.Notify targets of the event, which the reporter looks up in its
+//loaded config. Send errors are logged.
+func (task *Task) SendNotify(event string, t time.Time, attempt int, res exec.Result) {
+	if task.Notify == nil {
+		return
+	}
+	if len(task.Notify.targets(event)) == 0 {
+		return
+	}
+
+	n := Notification{
+		Event:      event,
+		Schedule:   task.ScheduleName,
+		Task:       task.Name,
+		Scheduled:  t,
+		Attempt:    attempt,
+		ExitStatus: res.ExitStatus,
+		TimedOut:   res.TimedOut,
+		Stderr:     tailLines(res.Stderr, notifyStderrLines),
+	}
+	if res.Error != nil {
+		n.Error = res.Error.Error()
+	}
+	if task.Git.Commit != nil {
+		n.Commit = task.Git.Commit.Hash.String()
+		n.Author = task.Git.Commit.Author.Email
+	}
+	if event == EventFailure && task.Notify.Author {
+		n.LastSuccessCommit, n.Commits = task.newCommits()
+		n.Authors = authors(n.Commits)
+	}
+
+	report(RunResult{CroniclePath: task.CroniclePath, Notification: &n})
+}
+
+//notifyTargets returns the targets of the notification event given by the notify block
+//of its task in conf, or of its schedule or conf if the task has none.
+func (conf *Config) notifyTargets(n Notification) []Target {
+	if conf == nil {
+		return nil
+	}
+	schedule, ok := conf.ScheduleMap()[n.Schedule]
+	if !ok {
+		return nil
+	}
+	notify := schedule.Notify
+	//a for_each instance, i.e. "bar[a]", has the notify block of its task
+	taskName := n.Task
+	if i := strings.Index(taskName, "["); i > 0 {
+		taskName = taskName[:i]
+	}
+	if task, ok := schedule.TaskMap()[taskName]; ok && task.Notify != nil {
+		notify = task.Notify
+	}
+	if notify == nil {
+		notify = conf.Notify
+	}
+	if notify == nil {
+		return nil
+	}
+	return notify.targets(n.Event)
+}
+
+//redacted returns a copy of notify with the target passwords masked
+func (notify *Notify) redacted() *Notify {
+	if notify == nil {
+		return nil
+	}
+	redact := func(targets []Target) []Target {
+		r := []Target{}
+		for _, target := range targets {
+			if target.Password != "" {
+				target.Password = "********"
+			}
+			r = append(r, target)
+		}
+		return r
+	}
+	n := *notify
+	n.OnFailure = redact(notify.OnFailure)
+	n.OnSuccess = redact(notify.OnSuccess)
+	n.OnRetry = redact(notify.OnRetry)
+	return &n
+}
+
+//hasPassword reports whether a target gives its password in cronicle.hcl rather than password_env
+func (notify *Notify) hasPassword() bool {
+	if notify == nil {
+		return false
+	}
+	for _, event := range []string{EventFailure, EventSuccess, EventRetry} {
+		for _, target := range notify.targets(event) {
+			if target.Password != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//Send sends the notification to the target
+func (target Target) Send(n Notification) error {
+	switch target.Type {
+	case TargetWebhook:
+		return postJSON(target.URL, n)
+	case TargetSlack:
+		return postJSON(target.URL, map[string]string{"text": n.Text()})
+	case TargetEmail:
+		return target.sendEmail(n)
+	}
+	return fmt.Errorf("unknown notify target type %q", target.Type)
+}
+
+//Subject returns the one line summary of the notification
+func (n Notification) Subject() string {
+	switch n.Event {
+	case EventConfigRejected:
+		return "cronicle: cronicle.hcl reload rejected, running the last valid config"
+	case EventRetry:
+		return fmt.Sprintf("cronicle: %s/%s attempt %d failed, retrying", n.Schedule, n.Task, n.Attempt)
+	case EventSuccess:
+		return fmt.Sprintf("cronicle: %s/%s succeeded", n.Schedule, n.Task)
+	}
+	return fmt.Sprintf("cronicle: %s/%s failed", n.Schedule, n.Task)
+}
+
+//Text returns the plain text message of the notification
+func (n Notification) Text() string {
+	var b strings.Builder
+	fmt.Fprintln(&b, n.Subject())
+	if n.Event == EventConfigRejected {
+		fmt.Fprintf(&b, "time: %s\n", n.Scheduled.Format(time.RFC3339))
+		fmt.Fprintf(&b, "error: %s\n", strings.TrimSpace(n.Error))
+		return b.String()
+	}
+	fmt.Fprintf(&b, "scheduled: %s\n", n.Scheduled.Format(time.RFC3339))
+	fmt.Fprintf(&b, "attempt: %d\n", n.Attempt)
+	fmt.Fprintf(&b, "exit: %d\n", n.ExitStatus)
+	if n.TimedOut {
+		fmt.Fprintln(&b, "timed out: true")
+	}
+	if n.Error != "" {
+		fmt.Fprintf(&b, "error: %s\n", strings.TrimSpace(n.Error))
+	}
+	if n.Commit != "" {
+		fmt.Fprintf(&b, "commit: %s by %s\n", n.Commit, n.Author)
+	}
+	if len(n.Commits) > 0 {
+		fmt.Fprintf(&b, "commits since the last success %s:\n", shortHash(n.LastSuccessCommit))
+		for _, c := range n.Commits {
+			fmt.Fprintf(&b, "  %s %s %s\n", shortHash(c.Hash), c.Author, c.Message)
+		}
+		if len(n.Authors) > 0 {
+			fmt.Fprintf(&b, "authors: %s\n", strings.Join(n.Authors, ", "))
+		}
+	}
+	if n.Stderr != "" {
+		fmt.Fprintf(&b, "stderr:\n```\n%s\n```\n", strings.TrimRight(n.Stderr, "\n"))
+	}
+	return b.String()
+}
+
+//notifyClient is the http client of webhook notifications
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+//postJSON posts v as json to url and errors on a non 2xx response
+func postJSON(url string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notify %s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+//sendEmail sends the notification text to the target recipients through target.SMTP
+func (target Target) sendEmail(n Notification) error {
+	var auth smtp.Auth
+	if target.Username != "" {
+		password := target.Password
+		if target.PasswordEnv != "" {
+			password = os.Getenv(target.PasswordEnv)
+		}
+		host := strings.Split(target.SMTP, ":")[0]
+		auth = smtp.PlainAuth("", target.Username, password, host)
+	}
+	to := target.To
+	for _, author := range n.Authors {
+		if !contains(to, author) {
+			to = append(to, author)
+		}
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s",
+		target.From, strings.Join(to, ", "), n.Subject(), strings.ReplaceAll(n.Text(), "\n", "\r\n"))
+	return sendMail(target.SMTP, auth, target.From, to, []byte(msg))
+}
+
+//smtpTimeout bounds the connection and the whole conversation with an smtp server
+const smtpTimeout = 30 * time.Second
+
+//sendMail is smtp.SendMail with a dial and io deadline of smtpTimeout, so that a hung smtp
+//server does not block the reporter
+func sendMail(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	for _, address := range append([]string{from}, to...) {
+		if strings.ContainsAny(address, "\r\n") {
+			return fmt.Errorf("smtp: address %q contains CR or LF", address)
+		}
+	}
+	conn, err := net.DialTimeout("tcp", addr, smtpTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); ok {
+			if err := c.Auth(auth); err != nil {
+				return err
+			}
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+//shortHash returns the 11 character abbreviated commit hash, as logged by task.Log
+func shortHash(hash string) string {
+	if len(hash) > 11 {
+		return hash[:11]
+	}
+	return hash
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+//tailLines returns the last n lines of s
+func tailLines(s string, n int) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,177 @@
+package cronicle_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+//fakeSMTP accepts a single mail and sends the DATA of the message to the returned channel
+func fakeSMTP() (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).To(BeNil())
+	messages := make(chan string, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		write := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		write("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				write("250 localhost")
+			case cmd == "DATA":
+				write("354 go ahead")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil || l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				messages <- data.String()
+				write("250 ok")
+			case cmd == "QUIT":
+				write("221 bye")
+				return
+			default:
+				write("250 ok")
+			}
+		}
+	}()
+	return l.Addr().String(), messages
+}
+
+var _ = Describe("Notify", func() {
+	var notifyPath string
+	var server *httptest.Server
+	var mu sync.Mutex
+	var received []map[string]interface{}
+
+	BeforeEach(func() {
+		notifyPath, _ = filepath.Abs("./test_notify/")
+		os.MkdirAll(notifyPath, 0777)
+		received = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			var v map[string]interface{}
+			json.Unmarshal(b, &v)
+			mu.Lock()
+			received = append(received, v)
+			mu.Unlock()
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(notifyPath)
+	})
+
+	//execBar writes the cronicle.hcl of schedule foo with task bar and executes task bar
+	execBar := func(command string, retry int, notify string) {
+		hcl := fmt.Sprintf(`schedule "foo" {
+  cron = "@every 1h"
+  task "bar" {
+    command = ["/bin/bash", "-c", %q]
+    retry {
+      count = %d
+    }
+    notify {
+%s
+    }
+  }
+}
+`, command, retry, notify)
+		cronicleFile := filepath.Join(notifyPath, "cronicle.hcl")
+		Expect(ioutil.WriteFile(cronicleFile, []byte(hcl), 0644)).To(BeNil())
+		cronicle.ExecTasks(cronicleFile, "bar", "foo", time.Now())
+	}
+
+	It("task.Execute should notify webhook targets on retry and failure with the stderr tail", func() {
+		execBar("echo oops >&2; exit 3", 2, fmt.Sprintf(`
+      on_failure "webhook" { url = %[1]q }
+      on_retry "webhook" { url = %[1]q }
+      on_success "webhook" { url = %[1]q }`, server.URL))
+
+		Expect(len(received)).To(Equal(2))
+		Expect(received[0]["Event"]).To(Equal(cronicle.EventRetry))
+		Expect(received[0]["Attempt"]).To(BeNumerically("==", 1))
+		Expect(received[1]["Event"]).To(Equal(cronicle.EventFailure))
+		Expect(received[1]["Attempt"]).To(BeNumerically("==", 2))
+		Expect(received[1]["ExitStatus"]).To(BeNumerically("==", 3))
+		Expect(received[1]["Stderr"]).To(Equal("oops"))
+	})
+
+	It("task.Execute should notify slack targets on success with a text message", func() {
+		execBar("echo ok", 0, fmt.Sprintf(`on_success "slack" { url = %q }`, server.URL))
+
+		Expect(len(received)).To(Equal(1))
+		Expect(received[0]["text"]).To(HavePrefix("cronicle: foo/bar succeeded"))
+	})
+
+	It("task.Execute should notify email targets through smtp", func() {
+		addr, messages := fakeSMTP()
+		execBar("exit 1", 0, fmt.Sprintf(`
+      on_failure "email" {
+        to   = ["ops@example.com"]
+        from = "cronicle@example.com"
+        smtp = %q
+      }`, addr))
+
+		var msg string
+		Eventually(messages).Should(Receive(&msg))
+		Expect(msg).To(ContainSubstring("Subject: cronicle: foo/bar failed"))
+		Expect(msg).To(ContainSubstring("exit: 1"))
+	})
+
+	It("task.Execute should keep the target passwords out of the queued schedule json", func() {
+		conf := cronicle.Default()
+		conf.Schedules[0].Tasks[0].Notify = &cronicle.Notify{OnFailure: []cronicle.Target{
+			{Type: cronicle.TargetEmail, To: []string{"ops@example.com"}, From: "cronicle@example.com", SMTP: "localhost:25", Password: "secret"},
+		}}
+		Expect(string(conf.Schedules[0].JSON())).ToNot(ContainSubstring("secret"))
+	})
+
+	It("conf.PropigateTaskProperties should inherit notify from the config and schedule", func() {
+		conf := cronicle.Default()
+		conf.Notify = &cronicle.Notify{OnFailure: []cronicle.Target{{Type: cronicle.TargetWebhook, URL: "http://config"}}}
+		conf.Schedules = append(conf.Schedules, conf.Schedules[0])
+		conf.Schedules[1].Name = "qux"
+		conf.Schedules[1].Tasks = []cronicle.Task{{Name: "bar"}}
+		conf.Schedules[1].Notify = &cronicle.Notify{OnFailure: []cronicle.Target{{Type: cronicle.TargetWebhook, URL: "http://schedule"}}}
+		conf.PropigateTaskProperties(notifyPath)
+		Expect(conf.Schedules[0].Tasks[0].Notify).To(Equal(conf.Notify))
+		Expect(conf.Schedules[1].Tasks[0].Notify).To(Equal(conf.Schedules[1].Notify))
+	})
+
+	It("conf.Validate() should error on a target without its required fields", func() {
+		conf := cronicle.Default()
+		conf.Schedules[0].Tasks[0].Notify = &cronicle.Notify{OnFailure: []cronicle.Target{{Type: cronicle.TargetEmail}}}
+		Expect(conf.Validate()).ToNot(BeNil())
+		conf.Schedules[0].Tasks[0].Notify = &cronicle.Notify{OnRetry: []cronicle.Target{{Type: "pager"}}}
+		Expect(conf.Validate()).ToNot(BeNil())
+	})
+})
@@ -0,0 +1,147 @@
+package cronicle
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+//OutputEnv is the environment variable holding the path of the file a task command
+//writes its outputs to, one key=value per line. i.e. echo "rows=42" >> $CRONICLE_OUTPUT
+//Downstream commands reference the outputs as ${task.<name>.<key>}
+const OutputEnv = "CRONICLE_OUTPUT"
+
+//outputRefPattern matches ${task.<name>.<key>} output references in a command
+var outputRefPattern = regexp.MustCompile(`\$\{task\.([^.}]+)\.([^.}]+)\}`)
+
+//outputRef returns the ${task.<name>.<key>} reference string
+func outputRef(taskName string, key string) string {
+	return fmt.Sprintf("${task.%s.%s}", taskName, key)
+}
+
+//readOutputs reads the key=value lines written to a CRONICLE_OUTPUT file,
+//blank lines and lines starting with # are ignored, later keys overwrite earlier ones.
+func readOutputs(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	outputs := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("%s line %d: %q is not a key=value output", OutputEnv, n, line)
+		}
+		outputs[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return outputs, scanner.Err()
+}
+
+//outputRefs returns the names of the tasks whose outputs are referenced in task.Command or task.ForEach
+func (task *Task) outputRefs() []string {
+	names := []string{}
+	for _, s := range append(append([]string{}, task.Command...), task.ForEach...) {
+		for _, m := range outputRefPattern.FindAllStringSubmatch(s, -1) {
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+//dependsOn returns true if task depends on the named task, directly or through other tasks
+func (task *Task) dependsOn(taskMap TaskMap, name string) bool {
+	visited := map[string]bool{}
+	var walk func(t Task) bool
+	walk = func(t Task) bool {
+		for _, dep := range t.Depends {
+			if dep == name {
+				return true
+			}
+			if visited[dep] {
+				continue
+			}
+			visited[dep] = true
+			if d, ok := taskMap[dep]; ok && walk(d) {
+				return true
+			}
+		}
+		return false
+	}
+	return walk(*task)
+}
+
+func (s *taskStates) setOutputs(taskName string, outputs map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outputs[taskName] = outputs
+}
+
+//allOutputs returns a copy of the outputs of the tasks that have completed
+func (s *taskStates) allOutputs() map[string]map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	outputs := make(map[string]map[string]string, len(s.outputs))
+	for name, o := range s.outputs {
+		outputs[name] = o
+	}
+	return outputs
+}
+
+//evalContext returns CommandEvalContext with a "task" variable for each ${task.<name>.<key>}
+//reference in body and the ${each.value} of for_each tasks, so that the references are carried
+//through as strings to be filled at execution time.
+func evalContext(body hcl.Body) *hcl.EvalContext {
+	refs := map[string]map[string]cty.Value{}
+	var walk func(b *hclsyntax.Body)
+	walk = func(b *hclsyntax.Body) {
+		for _, attr := range b.Attributes {
+			for _, traversal := range attr.Expr.Variables() {
+				if traversal.RootName() != "task" || len(traversal) != 3 {
+					continue
+				}
+				name, okName := traversal[1].(hcl.TraverseAttr)
+				key, okKey := traversal[2].(hcl.TraverseAttr)
+				if !okName || !okKey {
+					continue
+				}
+				if refs[name.Name] == nil {
+					refs[name.Name] = map[string]cty.Value{}
+				}
+				refs[name.Name][key.Name] = cty.StringVal(outputRef(name.Name, key.Name))
+			}
+		}
+		for _, block := range b.Blocks {
+			walk(block.Body)
+		}
+	}
+	if b, ok := body.(*hclsyntax.Body); ok {
+		walk(b)
+	}
+
+	ctx := hcl.EvalContext{Variables: map[string]cty.Value{}}
+	for k, v := range CommandEvalContext.Variables {
+		ctx.Variables[k] = v
+	}
+	ctx.Variables["each"] = cty.ObjectVal(map[string]cty.Value{"value": cty.StringVal(EachValueRef)})
+	if len(refs) > 0 {
+		tasks := map[string]cty.Value{}
+		for name, keys := range refs {
+			tasks[name] = cty.ObjectVal(keys)
+		}
+		ctx.Variables["task"] = cty.ObjectVal(tasks)
+	}
+	return &ctx
+}
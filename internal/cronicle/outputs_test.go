@@ -0,0 +1,83 @@
+package cronicle_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Outputs", func() {
+	var outputsPath string
+	var schedule cronicle.Schedule
+	t, _ := time.Parse(time.RFC3339, "2020-11-01T22:08:41+00:00")
+
+	BeforeEach(func() {
+		outputsPath, _ = filepath.Abs("./test_outputs/")
+		os.MkdirAll(outputsPath, 0777)
+		schedule = cronicle.Schedule{Name: "foo"}
+		schedule.Tasks = []cronicle.Task{
+			{Name: "extract", Command: []string{"/bin/bash", "-c", "echo rows=42 >> $CRONICLE_OUTPUT; echo 'file = a b.csv' >> $CRONICLE_OUTPUT"}},
+			{Name: "load", Command: []string{"/bin/bash", "-c", "echo ${task.extract.rows} ${task.extract.file} > load.txt"}, Depends: []string{"extract"}},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(outputsPath)
+	})
+
+	It("cronicle.ParseFile should carry ${task.<name>.<key>} references through as strings", func() {
+		cronicleFile := filepath.Join(outputsPath, "cronicle.hcl")
+		hcl := `schedule "foo" {
+  task "load" {
+    command = ["/bin/echo", "${task.extract.rows}", "--date=${date}"]
+    depends = ["extract"]
+  }
+}
+`
+		Expect(ioutil.WriteFile(cronicleFile, []byte(hcl), 0644)).To(BeNil())
+		conf, diags := cronicle.ParseFile(cronicleFile, hclparse.NewParser())
+		Expect(diags.HasErrors()).To(BeFalse())
+		Expect(conf.Schedules[0].Tasks[0].Command).To(Equal([]string{"/bin/echo", "${task.extract.rows}", "--date=${date}"}))
+	})
+
+	It("schedule.ExecuteTasks should fill downstream commands with upstream outputs", func() {
+		schedule.PropigateTaskProperties(outputsPath)
+		schedule.Now = t
+		schedule.ExecuteTasks()
+		b, err := ioutil.ReadFile(filepath.Join(outputsPath, "load.txt"))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal("42 a b.csv\n"))
+	})
+
+	It("task.Exec should fail on a reference to an output that was not written", func() {
+		schedule.Tasks[0].Command = []string{"/bin/echo", "no outputs"}
+		schedule.PropigateTaskProperties(outputsPath)
+		schedule.Now = t
+		schedule.ExecuteTasks()
+
+		records, err := cronicle.NewHistory(outputsPath).Query(cronicle.HistoryFilter{Task: "load"})
+		Expect(err).To(BeNil())
+		Expect(records[0].Status).To(Equal(cronicle.StatusFailed))
+		Expect(records[0].Error).To(ContainSubstring("${task.extract.rows}"))
+	})
+
+	It("task.Exec should fail on a malformed output line", func() {
+		task := schedule.Tasks[0]
+		task.Command = []string{"/bin/bash", "-c", "echo not-an-output >> $CRONICLE_OUTPUT"}
+		res := task.Exec(t)
+		Expect(res.Error).ToNot(BeNil())
+	})
+
+	It("conf.Validate() should error if a task references the outputs of a task it does not depend on", func() {
+		conf := cronicle.Config{Schedules: []cronicle.Schedule{schedule}}
+		Expect(conf.Validate()).To(BeNil())
+		conf.Schedules[0].Tasks[1].Depends = nil
+		Expect(conf.Validate()).ToNot(BeNil())
+	})
+})
@@ -83,7 +83,7 @@ func ParseFile(cronicleFile string, parser *hclparse.Parser) (*Config, hcl.Diagn
 	}
 
 	var conf Config
-	decodeDiags := gohcl.DecodeBody(file.Body, &CommandEvalContext, &conf)
+	decodeDiags := gohcl.DecodeBody(file.Body, evalContext(file.Body), &conf)
 	diags = append(diags, decodeDiags...)
 	if diags.HasErrors() {
 		return &conf, diags
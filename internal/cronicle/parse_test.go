@@ -78,7 +78,7 @@ var _ = Describe("Parse", func() {
 		conf := cronicle.Default()
 		schedule := conf.Schedules[0]
 		// schedule.Now = time.Now().In(time.Local)
-		s := `{"Name":"foo","Cron":"@every 5s","Timezone":"","StartDate":"","EndDate":"","Repo":null,"Tasks":[{"Name":"bar","Command":["/bin/echo","Hello World --date=${date}"],"Depends":null,"Repo":null,"Retry":null,"Env":null,"Path":"","CronicleRepo":null,"CroniclePath":"","Git":{"Worktree":null,"Repository":null,"Head":null,"Hash":null,"Commit":null,"ReferenceName":""},"ScheduleName":""}],"Now":"0001-01-01T00:00:00Z","CronicleRepo":null}`
+		s := `{"Name":"foo","Cron":"@every 5s","Timezone":"","StartDate":"","EndDate":"","Catchup":"","Concurrency":"","Timeout":"","RunLogs":null,"Notify":null,"RunOn":null,"Dispatch":"","Repo":null,"Tasks":[{"Name":"bar","Command":["/bin/echo","Hello World --date=${date}"],"Depends":null,"TriggerRule":"","ForEach":null,"Repo":null,"Retry":null,"Env":null,"Timeout":"","MaxOutput":0,"Notify":null,"RunOn":null,"Path":"","CronicleRepo":null,"CroniclePath":"","Git":{"Worktree":null,"Repository":null,"Head":null,"Hash":null,"Commit":null,"ReferenceName":""},"ScheduleName":""}],"Now":"0001-01-01T00:00:00Z","RunID":"","CronicleRepo":null,"CroniclePath":""}`
 
 		Expect(schedule.JSON()).To(Equal([]byte(s)))
 	})
@@ -0,0 +1,208 @@
+package cronicle
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/hashicorp/hcl/v2/hclparse"
+)
+
+//DefaultRedisAddr is the addr of the redis queue if neither --addr nor queue.addr is given
+const DefaultRedisAddr = "127.0.0.1:6379"
+
+//validateRedis checks the redis credentials, tls and pool options of the queue
+func (queue *Queue) validateRedis() error {
+	given := 0
+	for _, p := range []string{queue.Password, queue.PasswordFile, queue.PasswordEnv} {
+		if p != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		return errors.New("only one of password, password_file and password_env can be given")
+	}
+	if queue.DB < 0 {
+		return fmt.Errorf("db = %v must not be negative", queue.DB)
+	}
+	if queue.PoolSize < 0 || queue.MinIdleConns < 0 || queue.MaxRetries < 0 {
+		return errors.New("pool_size, min_idle_conns and max_retries must not be negative")
+	}
+	for field, v := range queue.timeouts() {
+		if v == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(v); err != nil {
+			return fmt.Errorf("%s: %w", field, err)
+		}
+	}
+	if queue.TLS != nil && (queue.TLS.CertFile == "") != (queue.TLS.KeyFile == "") {
+		return errors.New("tls {} cert_file and key_file must be given together")
+	}
+	return nil
+}
+
+//timeouts returns the queue timeout durations by hcl name
+func (queue *Queue) timeouts() map[string]string {
+	return map[string]string{
+		"dial_timeout":  queue.DialTimeout,
+		"read_timeout":  queue.ReadTimeout,
+		"write_timeout": queue.WriteTimeout,
+		"pool_timeout":  queue.PoolTimeout,
+		"idle_timeout":  queue.IdleTimeout,
+	}
+}
+
+//password returns the redis password given by password, password_file or password_env
+func (queue *Queue) password() (string, error) {
+	switch {
+	case queue.PasswordFile != "":
+		b, err := ioutil.ReadFile(queue.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("queue {} password_file: %w", err)
+		}
+		return strings.TrimSpace(string(b)), nil
+	case queue.PasswordEnv != "":
+		password, ok := os.LookupEnv(queue.PasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("queue {} password_env: $%s is not set", queue.PasswordEnv)
+		}
+		return password, nil
+	}
+	return queue.Password, nil
+}
+
+//tlsConfig returns the tls.Config of the queue tls block
+func (t *QueueTLS) tlsConfig(addr string) (*tls.Config, error) {
+	host := addr
+	if h, _, err := net.SplitHostPort(addr); err == nil {
+		host = h
+	}
+	config := &tls.Config{ServerName: host, InsecureSkipVerify: t.InsecureSkipVerify}
+	if t.ServerName != "" {
+		config.ServerName = t.ServerName
+	}
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("queue {} tls {} ca_file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("queue {} tls {} ca_file: no PEM certificates in %s", t.CAFile)
+		}
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("queue {} tls {} cert_file: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+//RedisOptions returns the redis client options of the queue at addr, or queue.Addr if addr
+//is empty. A nil queue connects to DefaultRedisAddr without a password over plain tcp.
+func (queue *Queue) RedisOptions(addr string) (*redis.Options, error) {
+	if queue == nil {
+		queue = &Queue{}
+	}
+	if addr == "" {
+		addr = queue.Addr
+	}
+	if addr == "" {
+		addr = DefaultRedisAddr
+	}
+	if err := queue.validateRedis(); err != nil {
+		return nil, fmt.Errorf("queue {} %w", err)
+	}
+	password, err := queue.password()
+	if err != nil {
+		return nil, err
+	}
+	opts := &redis.Options{
+		Network:      "tcp",
+		Addr:         addr,
+		Password:     password,
+		DB:           queue.DB,
+		MaxRetries:   queue.MaxRetries,
+		PoolSize:     queue.PoolSize,
+		MinIdleConns: queue.MinIdleConns,
+	}
+	timeouts := queue.timeouts()
+	for field, option := range map[string]*time.Duration{
+		"dial_timeout":  &opts.DialTimeout,
+		"read_timeout":  &opts.ReadTimeout,
+		"write_timeout": &opts.WriteTimeout,
+		"pool_timeout":  &opts.PoolTimeout,
+		"idle_timeout":  &opts.IdleTimeout,
+	} {
+		if v := timeouts[field]; v != "" {
+			*option, _ = time.ParseDuration(v)
+		}
+	}
+	if queue.TLS != nil {
+		if opts.TLSConfig, err = queue.TLS.tlsConfig(addr); err != nil {
+			return nil, err
+		}
+	}
+	if queue.Username != "" {
+		//redis 6 ACL users authenticate with AUTH <username> <password>, which this client
+		//does not send, so the AUTH and the SELECT of the db are sent once connected
+		db := opts.DB
+		opts.Password, opts.DB = "", 0
+		opts.OnConnect = func(conn *redis.Conn) error {
+			if err := conn.Do("auth", queue.Username, password).Err(); err != nil {
+				return err
+			}
+			if db > 0 {
+				return conn.Do("select", db).Err()
+			}
+			return nil
+		}
+	}
+	return opts, nil
+}
+
+//redacted returns a copy of the queue with the password masked
+func (queue *Queue) redacted() *Queue {
+	if queue == nil || queue.Password == "" {
+		return queue
+	}
+	q := *queue
+	q.Password = "********"
+	return &q
+}
+
+//loadQueue returns the queue block of the cronicle.hcl at path, or in the directory path.
+//A worker started in a directory without a cronicle.hcl has no queue block. The file is only
+//parsed, the repos of the config are not cloned into the directory of the worker.
+func loadQueue(path string) (*Queue, error) {
+	file := path
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		file = filepath.Join(path, "cronicle.hcl")
+	}
+	if !fileExists(file) {
+		return nil, nil
+	}
+	conf, diags := ParseFile(file, hclparse.NewParser())
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("cronicle.hcl parse: %w", diags)
+	}
+	if conf.Queue == nil {
+		return nil, nil
+	}
+	if err := conf.Queue.validateRedis(); err != nil {
+		return nil, err
+	}
+	return conf.Queue, nil
+}
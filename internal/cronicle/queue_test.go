@@ -0,0 +1,113 @@
+package cronicle_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Queue", func() {
+	var queuePath string
+
+	BeforeEach(func() {
+		queuePath, _ = filepath.Abs("./test_queue/")
+		os.MkdirAll(queuePath, 0777)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(queuePath)
+	})
+
+	It("conf.Validate() should error on invalid redis options", func() {
+		conf := cronicle.Default()
+		conf.Queue = &cronicle.Queue{Type: "redis", Password: "foo", PasswordEnv: "FOO"}
+		Expect(conf.Validate()).To(MatchError(ContainSubstring("only one of password")))
+
+		conf.Queue = &cronicle.Queue{Type: "redis", ReadTimeout: "3 seconds"}
+		Expect(conf.Validate()).To(MatchError(ContainSubstring("read_timeout")))
+
+		conf.Queue = &cronicle.Queue{Type: "redis", TLS: &cronicle.QueueTLS{CertFile: "cert.pem"}}
+		Expect(conf.Validate()).To(MatchError(ContainSubstring("cert_file and key_file")))
+
+		conf.Queue = &cronicle.Queue{Type: "redis", DB: 2, PoolSize: 20, DialTimeout: "5s"}
+		Expect(conf.Validate()).To(BeNil())
+	})
+
+	It("queue.RedisOptions() should pass the credentials, db and pool options to redis", func() {
+		var queue *cronicle.Queue
+		opts, err := queue.RedisOptions("")
+		Expect(err).To(BeNil())
+		Expect(opts.Addr).To(Equal(cronicle.DefaultRedisAddr))
+		Expect(opts.Password).To(Equal(""))
+		Expect(opts.TLSConfig).To(BeNil())
+
+		os.Setenv("CRONICLE_TEST_REDIS_PASSWORD", "secret")
+		defer os.Unsetenv("CRONICLE_TEST_REDIS_PASSWORD")
+		queue = &cronicle.Queue{
+			Addr:         "redis.example.com:6380",
+			PasswordEnv:  "CRONICLE_TEST_REDIS_PASSWORD",
+			DB:           2,
+			PoolSize:     20,
+			MaxRetries:   3,
+			DialTimeout:  "5s",
+			ReadTimeout:  "3s",
+			TLS:          &cronicle.QueueTLS{InsecureSkipVerify: true},
+			MinIdleConns: 1,
+		}
+		opts, err = queue.RedisOptions("")
+		Expect(err).To(BeNil())
+		Expect(opts.Addr).To(Equal("redis.example.com:6380"))
+		Expect(opts.Password).To(Equal("secret"))
+		Expect(opts.DB).To(Equal(2))
+		Expect(opts.PoolSize).To(Equal(20))
+		Expect(opts.MinIdleConns).To(Equal(1))
+		Expect(opts.MaxRetries).To(Equal(3))
+		Expect(opts.DialTimeout).To(Equal(5 * time.Second))
+		Expect(opts.ReadTimeout).To(Equal(3 * time.Second))
+		Expect(opts.TLSConfig.ServerName).To(Equal("redis.example.com"))
+		Expect(opts.TLSConfig.InsecureSkipVerify).To(BeTrue())
+
+		opts, err = queue.RedisOptions("127.0.0.1:6379")
+		Expect(err).To(BeNil())
+		Expect(opts.Addr).To(Equal("127.0.0.1:6379"))
+	})
+
+	It("queue.RedisOptions() should read the password of password_file", func() {
+		file := filepath.Join(queuePath, "password")
+		ioutil.WriteFile(file, []byte("secret\n"), 0600)
+		queue := &cronicle.Queue{PasswordFile: file}
+		opts, err := queue.RedisOptions("")
+		Expect(err).To(BeNil())
+		Expect(opts.Password).To(Equal("secret"))
+
+		queue = &cronicle.Queue{PasswordEnv: "CRONICLE_TEST_REDIS_UNSET"}
+		_, err = queue.RedisOptions("")
+		Expect(err).To(MatchError(ContainSubstring("$CRONICLE_TEST_REDIS_UNSET is not set")))
+	})
+
+	It("queue.RedisOptions() should authenticate an ACL user once connected", func() {
+		queue := &cronicle.Queue{Username: "cronicle", Password: "secret", DB: 2}
+		opts, err := queue.RedisOptions("")
+		Expect(err).To(BeNil())
+		Expect(opts.Password).To(Equal(""))
+		Expect(opts.DB).To(Equal(0))
+		Expect(opts.OnConnect).ToNot(BeNil())
+	})
+
+	It("queue.RedisOptions() should error on a tls ca_file without certificates", func() {
+		file := filepath.Join(queuePath, "ca.pem")
+		ioutil.WriteFile(file, []byte("not a certificate"), 0600)
+		queue := &cronicle.Queue{TLS: &cronicle.QueueTLS{CAFile: file}}
+		_, err := queue.RedisOptions("")
+		Expect(err).To(MatchError(ContainSubstring("no PEM certificates")))
+
+		queue = &cronicle.Queue{TLS: &cronicle.QueueTLS{CAFile: filepath.Join(queuePath, "missing.pem")}}
+		_, err = queue.RedisOptions("")
+		Expect(err).To(MatchError(ContainSubstring("ca_file")))
+	})
+})
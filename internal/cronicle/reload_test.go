@@ -0,0 +1,182 @@
+package cronicle_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	cron "github.com/robfig/cron/v3"
+)
+
+var _ = Describe("Reload", func() {
+	var reloadPath string
+	var cronicleFile string
+	var server *httptest.Server
+	var mu sync.Mutex
+	var received []map[string]interface{}
+	var c *cron.Cron
+	queue := make(chan []byte, 1)
+
+	write := func(schedules string) {
+		hcl := `notify {
+  on_failure "webhook" {
+    url = "` + server.URL + `"
+  }
+}
+` + schedules
+		Expect(ioutil.WriteFile(cronicleFile, []byte(hcl), 0644)).To(BeNil())
+	}
+
+	scheduleNames := func() []string {
+		w := httptest.NewRecorder()
+		cronicle.APIHandler().ServeHTTP(w, httptest.NewRequest("GET", "/api/schedules", nil))
+		var statuses []cronicle.ScheduleStatus
+		json.Unmarshal(w.Body.Bytes(), &statuses)
+		names := []string{}
+		for _, status := range statuses {
+			names = append(names, status.Name)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		reloadPath, _ = filepath.Abs("./test_reload/")
+		os.MkdirAll(reloadPath, 0777)
+		cronicleFile = filepath.Join(reloadPath, "cronicle.hcl")
+		received = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			var v map[string]interface{}
+			json.Unmarshal(b, &v)
+			mu.Lock()
+			received = append(received, v)
+			mu.Unlock()
+		}))
+		c = cron.New()
+		//stands in for the heartbeat entry which LoadCron does not remove
+		c.AddFunc("@every 24h", func() {})
+		write(`schedule "foo" {
+  cron = "@every 1h"
+  task "bar" {
+    command = ["/bin/echo", "bar"]
+  }
+}
+`)
+		cronicle.LoadCron(cronicleFile, c, queue, true)
+		Expect(len(c.Entries())).To(Equal(2))
+	})
+
+	AfterEach(func() {
+		c.Stop()
+		server.Close()
+		os.RemoveAll(reloadPath)
+	})
+
+	It("LoadCron should keep the last valid schedules and notify once when the cron is invalid", func() {
+		write(`schedule "foo" {
+  cron = "@every nope"
+  task "bar" {
+    command = ["/bin/echo", "bar"]
+  }
+}
+`)
+		cronicle.LoadCron(cronicleFile, c, queue, false)
+		cronicle.LoadCron(cronicleFile, c, queue, false)
+		Expect(len(c.Entries())).To(Equal(2))
+		Expect(scheduleNames()).To(Equal([]string{"foo"}))
+		Expect(len(received)).To(Equal(1))
+		Expect(received[0]["Event"]).To(Equal(cronicle.EventConfigRejected))
+		Expect(received[0]["Error"]).To(ContainSubstring("@every nope"))
+	})
+
+	It("LoadCron should reject a config with a dependency cycle or an hcl error", func() {
+		write(`schedule "qux" {
+  cron = "@every 1h"
+  task "a" {
+    command = ["/bin/echo", "a"]
+    depends = ["b"]
+  }
+  task "b" {
+    command = ["/bin/echo", "b"]
+    depends = ["a"]
+  }
+}
+`)
+		cronicle.LoadCron(cronicleFile, c, queue, false)
+		Expect(scheduleNames()).To(Equal([]string{"foo"}))
+
+		write(`schedule "qux" {`)
+		cronicle.LoadCron(cronicleFile, c, queue, false)
+		Expect(scheduleNames()).To(Equal([]string{"foo"}))
+		Expect(len(received)).To(Equal(2))
+	})
+
+	It("LoadCron should load a valid config after a rejected config", func() {
+		write(`schedule "foo" {
+  cron = "@every nope"
+}
+`)
+		cronicle.LoadCron(cronicleFile, c, queue, false)
+		write(`schedule "qux" {
+  cron = "@every 2h"
+  task "bar" {
+    command = ["/bin/echo", "bar"]
+  }
+}
+`)
+		cronicle.LoadCron(cronicleFile, c, queue, false)
+		Expect(len(c.Entries())).To(Equal(2))
+		Expect(scheduleNames()).To(Equal([]string{"qux"}))
+	})
+
+	It("LoadCron should only replace the cron entries of added, removed and changed schedules", func() {
+		entryIDs := func() map[string]cron.EntryID {
+			ids := map[string]cron.EntryID{}
+			for _, entry := range c.Entries() {
+				ids[entry.Schedule.Next(time.Time{}).Sub(time.Time{}).String()] = entry.ID
+			}
+			return ids
+		}
+		before := entryIDs()
+
+		write(`schedule "foo" {
+  cron = "@every 1h"
+  task "bar" {
+    command = ["/bin/echo", "bar"]
+  }
+}
+schedule "qux" {
+  cron = "@every 2h"
+  task "bar" {
+    command = ["/bin/echo", "bar"]
+  }
+}
+`)
+		cronicle.LoadCron(cronicleFile, c, queue, false)
+		after := entryIDs()
+		Expect(len(c.Entries())).To(Equal(3))
+		Expect(after["1h0m0s"]).To(Equal(before["1h0m0s"]))
+		Expect(scheduleNames()).To(Equal([]string{"foo", "qux"}))
+
+		write(`schedule "qux" {
+  cron = "@every 3h"
+  task "bar" {
+    command = ["/bin/echo", "bar"]
+  }
+}
+`)
+		cronicle.LoadCron(cronicleFile, c, queue, false)
+		Expect(len(c.Entries())).To(Equal(2))
+		Expect(entryIDs()).To(HaveKey("3h0m0s"))
+		Expect(entryIDs()).ToNot(HaveKey("2h0m0s"))
+		Expect(scheduleNames()).To(Equal([]string{"qux"}))
+	})
+})
@@ -0,0 +1,191 @@
+package cronicle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//ResultsQueueSuffix names the queue that workers publish run results to, i.e. "cronicle-results"
+const ResultsQueueSuffix = "-results"
+
+//resultReporter reports the results of the runs executed by this process,
+//StartWorker replaces it with a QueueReporter in distributed mode.
+var resultReporter Reporter = LocalReporter{}
+
+//workerID identifies this process in the run results, i.e. "host:1234"
+var workerID = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}()
+
+//RunResult is a task attempt or schedule run, or a notification of a task event,
+//reported by the worker that executed it.
+type RunResult struct {
+	//CroniclePath is the cronicle path of the worker, a LocalReporter without a
+	//CroniclePath records the run history there
+	CroniclePath string
+	Record       *RunRecord    `json:",omitempty"`
+	Notification *Notification `json:",omitempty"`
+	Ack          *Ack          `json:",omitempty"`
+	Worker       *WorkerStatus `json:",omitempty"`
+	Task         *TaskResult   `json:",omitempty"`
+}
+
+//Reporter records the results of task attempts and schedule runs
+type Reporter interface {
+	Report(result RunResult)
+}
+
+//LocalReporter records run results in the run history at CroniclePath, observes
+//the run metrics, sends notifications to the targets of the loaded config, acks delivered runs,
+//registers worker heartbeats and releases the dependents of dispatched tasks.
+type LocalReporter struct {
+	CroniclePath string
+	//Config holds the notify targets of the notifications, which are looked up by schedule and task
+	//so that the target passwords stay on this node [default: the last valid config loaded]
+	Config *Config
+}
+
+//Report records result
+func (r LocalReporter) Report(result RunResult) {
+	if result.Record != nil {
+		rec := *result.Record
+		observeRecord(rec)
+		path := r.CroniclePath
+		if path == "" {
+			path = result.CroniclePath
+		}
+		if path != "" {
+			if err := NewHistory(path).Record(&rec); err != nil {
+				log.WithFields(log.Fields{"schedule": rec.Schedule, "task": rec.Task}).Error(err)
+			}
+		}
+	}
+	if result.Worker != nil {
+		workerRegistry.update(*result.Worker)
+		path := r.CroniclePath
+		if path == "" {
+			path = result.CroniclePath
+		}
+		if path != "" {
+			if err := NewHistory(path).SetWorker(*result.Worker); err != nil {
+				log.WithFields(log.Fields{"worker": result.Worker.ID}).Error(err)
+			}
+		}
+	}
+	if result.Ack != nil && deliveryGlobal != nil {
+		deliveryGlobal.Ack(*result.Ack)
+	}
+	if result.Task != nil {
+		taskDispatcher.Complete(*result.Task)
+	}
+	if result.Notification != nil {
+		n := *result.Notification
+		conf := r.Config
+		if conf == nil {
+			conf = confPrior()
+		}
+		for _, target := range conf.notifyTargets(n) {
+			if err := target.Send(n); err != nil {
+				log.WithFields(log.Fields{
+					"schedule": n.Schedule,
+					"task":     n.Task,
+					"notify":   target.Type,
+					"event":    n.Event,
+				}).Error(err)
+			}
+		}
+	}
+}
+
+//QueueReporter publishes run results as json to Queue, which is consumed by
+//ConsumeResults on the cronicle run node. The run metrics are observed before the
+//result is published so that the /metrics of the worker count the runs it executed.
+type QueueReporter struct {
+	Queue chan<- []byte
+}
+
+//Report publishes result
+func (r QueueReporter) Report(result RunResult) {
+	if result.Record != nil {
+		observeRecord(*result.Record)
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	r.Queue <- b
+}
+
+//report reports result with the resultReporter of the process
+func report(result RunResult) {
+	resultReporter.Report(result)
+}
+
+//notifyQueueSize bounds the notifications waiting to be sent by ConsumeResults
+const notifyQueueSize = 1000
+
+//ConsumeResults consumes the run results published by workers and reports them with reporter,
+//which centralizes the run history, metrics and notifications on the cronicle run node.
+//Notifications are reported on their own goroutine so that a slow notify target does not hold
+//up the acks, task results and history of the other runs, they are dropped if the notify queue
+//is full. ConsumeResults returns once results is closed and the queued notifications were sent.
+func ConsumeResults(results <-chan []byte, reporter Reporter) {
+	notifications := make(chan RunResult, notifyQueueSize)
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for result := range notifications {
+			reporter.Report(result)
+		}
+	}()
+	for b := range results {
+		var result RunResult
+		if err := json.Unmarshal(b, &result); err != nil {
+			log.WithFields(log.Fields{"cronicle": "results"}).Error(err)
+			continue
+		}
+		if n := result.Notification; n != nil {
+			select {
+			case notifications <- RunResult{CroniclePath: result.CroniclePath, Notification: n}:
+			default:
+				log.WithFields(log.Fields{"cronicle": "results", "schedule": n.Schedule, "task": n.Task, "event": n.Event}).Error("Notify queue is full, dropping the notification")
+			}
+			result.Notification = nil
+		}
+		reporter.Report(result)
+	}
+	close(notifications)
+	<-sent
+}
+
+//observeRecord records the metrics of a task attempt or schedule run
+func observeRecord(rec RunRecord) {
+	switch {
+	case rec.Kind == RunKindSchedule:
+		if rec.Status == StatusSuccess {
+			scheduleLastSuccess.WithLabelValues(rec.Schedule).Set(float64(rec.End.UnixNano()) / float64(time.Second))
+		}
+	case rec.Status == StatusSkipped:
+	case rec.Attempt == 0:
+		//the task repo could not be prepared
+		taskFailures.WithLabelValues(rec.Schedule, rec.Task).Inc()
+	default:
+		taskAttempts.WithLabelValues(rec.Schedule, rec.Task).Inc()
+		if rec.Attempt > 1 {
+			taskRetries.WithLabelValues(rec.Schedule, rec.Task).Inc()
+		}
+		taskDuration.WithLabelValues(rec.Schedule, rec.Task).Observe(rec.End.Sub(rec.Start).Seconds())
+		if rec.Status == StatusSuccess {
+			taskSuccess.WithLabelValues(rec.Schedule, rec.Task).Inc()
+			taskLastSuccess.WithLabelValues(rec.Schedule, rec.Task).Set(float64(rec.End.UnixNano()) / float64(time.Second))
+		} else {
+			taskFailures.WithLabelValues(rec.Schedule, rec.Task).Inc()
+		}
+	}
+}
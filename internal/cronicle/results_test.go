@@ -0,0 +1,124 @@
+package cronicle_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Results", func() {
+	var resultsPath string
+
+	BeforeEach(func() {
+		resultsPath, _ = filepath.Abs("./test_results/")
+		os.MkdirAll(resultsPath, 0777)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(resultsPath)
+	})
+
+	It("schedule.ExecuteTasks should record the run id and worker of each run", func() {
+		schedule := cronicle.Schedule{Name: "foo", Now: time.Now()}
+		schedule.Tasks = []cronicle.Task{{Name: "bar", Command: []string{"/bin/echo", "bar"}}}
+		schedule.PropigateTaskProperties(resultsPath)
+		schedule.ExecuteTasks()
+
+		records, err := cronicle.NewHistory(resultsPath).Query(cronicle.HistoryFilter{})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(2))
+		Expect(records[0].RunID).ToNot(BeEmpty())
+		Expect(records[0].RunID).To(Equal(records[1].RunID))
+		Expect(records[0].Worker).ToNot(BeEmpty())
+	})
+
+	It("cronicle.ConsumeResults should record the results published by a QueueReporter", func() {
+		queue := make(chan []byte, 2)
+		reporter := cronicle.QueueReporter{Queue: queue}
+		reporter.Report(cronicle.RunResult{
+			CroniclePath: "/worker/path",
+			Record: &cronicle.RunRecord{
+				Kind:     cronicle.RunKindTask,
+				Schedule: "foo",
+				Task:     "bar",
+				Attempt:  1,
+				Status:   cronicle.StatusFailed,
+				RunID:    "run1",
+				Worker:   "worker1",
+			},
+		})
+
+		var received []cronicle.Notification
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			b, _ := ioutil.ReadAll(r.Body)
+			var n cronicle.Notification
+			json.Unmarshal(b, &n)
+			received = append(received, n)
+		}))
+		defer server.Close()
+		reporter.Report(cronicle.RunResult{
+			Notification: &cronicle.Notification{Event: cronicle.EventFailure, Schedule: "foo", Task: "bar"},
+		})
+		close(queue)
+
+		//the notify targets are looked up in the config of the run node
+		conf := cronicle.Default()
+		conf.Schedules[0].Tasks[0].Notify = &cronicle.Notify{OnFailure: []cronicle.Target{{Type: cronicle.TargetWebhook, URL: server.URL}}}
+		cronicle.ConsumeResults(queue, cronicle.LocalReporter{CroniclePath: resultsPath, Config: &conf})
+
+		records, err := cronicle.NewHistory(resultsPath).Query(cronicle.HistoryFilter{})
+		Expect(err).To(BeNil())
+		Expect(len(records)).To(Equal(1))
+		Expect(records[0].RunID).To(Equal("run1"))
+		Expect(records[0].Worker).To(Equal("worker1"))
+		Expect(records[0].Status).To(Equal(cronicle.StatusFailed))
+		Expect(len(received)).To(Equal(1))
+		Expect(received[0].Event).To(Equal(cronicle.EventFailure))
+	})
+
+	It("cronicle.ConsumeResults should record results while a notify target hangs", func() {
+		release := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer server.Close()
+		conf := cronicle.Default()
+		conf.Schedules[0].Tasks[0].Notify = &cronicle.Notify{OnFailure: []cronicle.Target{{Type: cronicle.TargetWebhook, URL: server.URL}}}
+
+		queue := make(chan []byte, 2)
+		reporter := cronicle.QueueReporter{Queue: queue}
+		reporter.Report(cronicle.RunResult{
+			Notification: &cronicle.Notification{Event: cronicle.EventFailure, Schedule: "foo", Task: "bar"},
+		})
+		reporter.Report(cronicle.RunResult{Record: &cronicle.RunRecord{
+			Kind:     cronicle.RunKindTask,
+			Schedule: "foo",
+			Task:     "bar",
+			Attempt:  1,
+			Status:   cronicle.StatusSuccess,
+			RunID:    "run2",
+		}})
+		close(queue)
+		done := make(chan struct{})
+		go func() {
+			cronicle.ConsumeResults(queue, cronicle.LocalReporter{CroniclePath: resultsPath, Config: &conf})
+			close(done)
+		}()
+
+		Eventually(func() int {
+			records, _ := cronicle.NewHistory(resultsPath).Query(cronicle.HistoryFilter{})
+			return len(records)
+		}).Should(Equal(1))
+		Consistently(done, 50*time.Millisecond).ShouldNot(BeClosed())
+		close(release)
+		Eventually(done).Should(BeClosed())
+	})
+})
@@ -0,0 +1,145 @@
+package cronicle
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/matryer/vice"
+)
+
+//maxWorkerLabels caps the labels of a worker, a worker consumes the label queue of each subset of its labels
+const maxWorkerLabels = 6
+
+//labelPattern is the format of a run_on or worker label, labels are part of the
+//label queue names and are limited to the characters nsq accepts in a topic name.
+var labelPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+//queueRouter routes the schedules produced by this process to the label queues of their
+//run_on labels, Run sets it to the transport of the queue in distributed mode.
+var queueRouter *Router
+
+//Router routes schedules with run_on labels to the label queue of the labels,
+//schedules without labels are produced to the queue they are given.
+type Router struct {
+	queueName string
+	send      func(name string) chan<- []byte
+}
+
+//NewRouter returns a Router that produces to the label queues of queueName given by send, i.e. transport.Send
+func NewRouter(queueName string, send func(name string) chan<- []byte) *Router {
+	return &Router{queueName: queueName, send: send}
+}
+
+//Route returns the queue that schedule is produced to, the label queue of the
+//run_on labels of the schedule or queue if the schedule has none. A nil Router returns queue.
+func (r *Router) Route(queue chan<- []byte, schedule Schedule) chan<- []byte {
+	return r.RouteLabels(queue, schedule.RunOnLabels())
+}
+
+//RouteLabels returns the label queue of the given run_on labels, or queue if there are none
+func (r *Router) RouteLabels(queue chan<- []byte, labels []string) chan<- []byte {
+	labels = normalizeLabels(labels)
+	if r == nil || len(labels) == 0 {
+		return queue
+	}
+	return r.send(LabelQueue(r.queueName, labels))
+}
+
+//RunOnLabels returns the sorted labels a worker must have to run the schedule, the run_on
+//labels of the schedule and of its tasks, since all tasks of a schedule run execute on one worker.
+func (schedule Schedule) RunOnLabels() []string {
+	labels := append([]string{}, schedule.RunOn...)
+	for _, task := range schedule.Tasks {
+		labels = append(labels, task.RunOn...)
+	}
+	return normalizeLabels(labels)
+}
+
+//LabelQueue returns the name of the queue that schedules with the given run_on labels
+//are routed to, i.e. "cronicle.gpu.us-east", or queueName if there are no labels.
+func LabelQueue(queueName string, labels []string) string {
+	labels = normalizeLabels(labels)
+	if len(labels) == 0 {
+		return queueName
+	}
+	return queueName + "." + strings.Join(labels, ".")
+}
+
+//LabelQueues returns the names of the queues a worker with the given labels consumes,
+//queueName for schedules without labels and the label queue of each subset of the labels.
+func LabelQueues(queueName string, labels []string) []string {
+	labels = normalizeLabels(labels)
+	names := []string{queueName}
+	for mask := 1; mask < 1<<len(labels); mask++ {
+		subset := []string{}
+		for i, label := range labels {
+			if mask&(1<<i) != 0 {
+				subset = append(subset, label)
+			}
+		}
+		names = append(names, LabelQueue(queueName, subset))
+	}
+	return names
+}
+
+//normalizeLabels returns the sorted distinct labels
+func normalizeLabels(labels []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, label := range labels {
+		if !seen[label] {
+			seen[label] = true
+			normalized = append(normalized, label)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+//validateLabels checks the format of run_on or worker labels
+func validateLabels(labels []string) error {
+	for _, label := range labels {
+		if !labelPattern.MatchString(label) {
+			return fmt.Errorf(`label "%s" must only contain letters, digits, "_" and "-"`, label)
+		}
+	}
+	return nil
+}
+
+//validateWorkerLabels checks the format and number of the labels of a worker
+func validateWorkerLabels(labels []string) error {
+	if err := validateLabels(labels); err != nil {
+		return fmt.Errorf("--labels: %w", err)
+	}
+	if n := len(normalizeLabels(labels)); n > maxWorkerLabels {
+		return fmt.Errorf("--labels: a worker can have at most %d labels, got %d", maxWorkerLabels, n)
+	}
+	return nil
+}
+
+//receiveSchedules returns the schedules of the queues a worker with the given labels consumes, merged into one channel
+func receiveSchedules(transport vice.Transport, queueName string, labels []string) <-chan []byte {
+	names := LabelQueues(queueName, labels)
+	if len(names) == 1 {
+		return transport.Receive(queueName)
+	}
+	schedules := make(chan []byte)
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(queue <-chan []byte) {
+			defer wg.Done()
+			for b := range queue {
+				schedules <- b
+			}
+		}(transport.Receive(name))
+	}
+	go func() {
+		wg.Wait()
+		close(schedules)
+	}()
+	return schedules
+}
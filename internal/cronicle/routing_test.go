@@ -0,0 +1,69 @@
+package cronicle_test
+
+import (
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Routing", func() {
+
+	It("RunOnLabels should merge the sorted run_on labels of the schedule and its tasks", func() {
+		schedule := cronicle.Schedule{
+			Name:  "foo",
+			RunOn: []string{"us-east", "gpu"},
+			Tasks: []cronicle.Task{{Name: "bar", RunOn: []string{"gpu", "nfs"}}, {Name: "baz"}},
+		}
+		Expect(schedule.RunOnLabels()).To(Equal([]string{"gpu", "nfs", "us-east"}))
+		Expect(cronicle.Schedule{Name: "foo"}.RunOnLabels()).To(BeEmpty())
+	})
+
+	It("LabelQueue should name the queue of the sorted labels", func() {
+		Expect(cronicle.LabelQueue("cronicle", nil)).To(Equal("cronicle"))
+		Expect(cronicle.LabelQueue("cronicle", []string{"us-east", "gpu"})).To(Equal("cronicle.gpu.us-east"))
+	})
+
+	It("LabelQueues should list the queue and the label queue of each subset of the worker labels", func() {
+		Expect(cronicle.LabelQueues("cronicle", nil)).To(Equal([]string{"cronicle"}))
+		Expect(cronicle.LabelQueues("cronicle", []string{"us-east", "gpu"})).To(ConsistOf(
+			"cronicle",
+			"cronicle.gpu",
+			"cronicle.us-east",
+			"cronicle.gpu.us-east",
+		))
+	})
+
+	It("Router.Route should produce labeled schedules to the label queue", func() {
+		queues := map[string]chan []byte{}
+		send := func(name string) chan<- []byte {
+			if _, ok := queues[name]; !ok {
+				queues[name] = make(chan []byte, 1)
+			}
+			return queues[name]
+		}
+		queue := make(chan []byte, 1)
+		r := cronicle.NewRouter("cronicle", send)
+
+		Expect(r.Route(queue, cronicle.Schedule{Name: "foo"})).To(Equal((chan<- []byte)(queue)))
+		r.Route(queue, cronicle.Schedule{Name: "foo", RunOn: []string{"gpu"}}) <- []byte("foo")
+		Expect(queues).To(HaveKey("cronicle.gpu"))
+		Expect(<-queues["cronicle.gpu"]).To(Equal([]byte("foo")))
+
+		var nilRouter *cronicle.Router
+		Expect(nilRouter.Route(queue, cronicle.Schedule{Name: "foo", RunOn: []string{"gpu"}})).To(Equal((chan<- []byte)(queue)))
+	})
+
+	It("Validate should reject run_on labels that can not name a queue", func() {
+		conf := cronicle.Default()
+		conf.Schedules[0].RunOn = []string{"gpu"}
+		conf.Schedules[0].Tasks[0].RunOn = []string{"us-east"}
+		Expect(conf.Validate()).To(Succeed())
+
+		conf.Schedules[0].RunOn = []string{"gpu host"}
+		Expect(conf.Validate()).To(MatchError(ContainSubstring(`run_on: label "gpu host"`)))
+
+		conf.Schedules[0].RunOn = nil
+		conf.Schedules[0].Tasks[0].RunOn = []string{""}
+		Expect(conf.Validate()).To(MatchError(ContainSubstring(`task "bar" {} run_on`)))
+	})
+})
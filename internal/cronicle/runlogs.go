@@ -0,0 +1,184 @@
+package cronicle
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//runTimeFormat names the run log directory of a scheduled time, it is in UTC so that
+//directory names sort chronologically.
+const runTimeFormat = "20060102T150405Z"
+
+// RunLogs is the retention policy for the per run task logs kept at
+// .cronicle/runs/<schedule>/<task>/<scheduled-time>/<attempt>.log
+type RunLogs struct {
+	// Retention is the age of a run after which its logs are pruned, i.e. "720h"
+	Retention string `hcl:"retention,optional"`
+	// MaxRuns is the number of most recent runs kept per task, 0 keeps all runs
+	MaxRuns int `hcl:"max_runs,optional"`
+}
+
+//RunLogDir returns the directory holding the attempt logs of a task run scheduled at t
+func RunLogDir(croniclePath string, scheduleName string, taskName string, t time.Time) string {
+	return filepath.Join(croniclePath, ".cronicle", "runs", scheduleName, taskName, t.UTC().Format(runTimeFormat))
+}
+
+//RunLogPath returns the log file of the given attempt of a task run scheduled at t
+func RunLogPath(croniclePath string, scheduleName string, taskName string, t time.Time, attempt int) string {
+	return filepath.Join(RunLogDir(croniclePath, scheduleName, taskName, t), fmt.Sprintf("%d.log", attempt))
+}
+
+//openRunLog opens the log file for the given attempt of the task run scheduled at t, it is appended
+//to so that another run of the same scheduled time, i.e. a trigger or a catch up, keeps the output of the first.
+func (task *Task) openRunLog(t time.Time, attempt int) (*os.File, error) {
+	p := RunLogPath(task.CroniclePath, task.ScheduleName, task.Name, t, attempt)
+	if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+}
+
+//PruneRunLogs removes the run logs of the schedule tasks that are older than
+//schedule.RunLogs.Retention or beyond the most recent schedule.RunLogs.MaxRuns.
+func (schedule *Schedule) PruneRunLogs(now time.Time) {
+	if schedule.RunLogs == nil || schedule.CroniclePath == "" {
+		return
+	}
+	var retention time.Duration
+	if schedule.RunLogs.Retention != "" {
+		var err error
+		if retention, err = time.ParseDuration(schedule.RunLogs.Retention); err != nil {
+			log.WithFields(log.Fields{"schedule": schedule.Name}).Error(err)
+			return
+		}
+	}
+
+	//Prune every task dir of the schedule, which includes for_each instances and removed tasks
+	scheduleDir := filepath.Join(schedule.CroniclePath, ".cronicle", "runs", schedule.Name)
+	for _, taskName := range runLogRuns(scheduleDir) {
+		taskDir := filepath.Join(scheduleDir, taskName)
+		runs := runLogRuns(taskDir)
+		for i, run := range runs {
+			t, err := time.Parse(runTimeFormat, run)
+			expired := err == nil && retention > 0 && now.Sub(t) > retention
+			excess := schedule.RunLogs.MaxRuns > 0 && i < len(runs)-schedule.RunLogs.MaxRuns
+			if expired || excess {
+				if err := os.RemoveAll(filepath.Join(taskDir, run)); err != nil {
+					log.WithFields(log.Fields{"schedule": schedule.Name, "task": taskName}).Error(err)
+				}
+			}
+		}
+	}
+}
+
+//runLogRuns lists the sub directories of a log dir, i.e. the runs of a task dir oldest first
+func runLogRuns(taskDir string) []string {
+	runs := []string{}
+	infos, err := ioutil.ReadDir(taskDir)
+	if err != nil {
+		return runs
+	}
+	for _, info := range infos {
+		if info.IsDir() {
+			runs = append(runs, info.Name())
+		}
+	}
+	sort.Strings(runs)
+	return runs
+}
+
+//runLogAttempts lists the attempt log files of a run dir, in attempt order
+func runLogAttempts(runDir string) []string {
+	attempts := []string{}
+	infos, err := ioutil.ReadDir(runDir)
+	if err != nil {
+		return attempts
+	}
+	for _, info := range infos {
+		if !info.IsDir() && strings.HasSuffix(info.Name(), ".log") {
+			attempts = append(attempts, info.Name())
+		}
+	}
+	sort.Slice(attempts, func(i, j int) bool {
+		var a, b int
+		fmt.Sscanf(attempts[i], "%d.log", &a)
+		fmt.Sscanf(attempts[j], "%d.log", &b)
+		return a < b
+	})
+	return attempts
+}
+
+//PrintRunLogs writes the attempt logs of a task run to w. The run scheduled at t is
+//printed, or the latest run if t is zero. If follow is true the last attempt log is
+//followed for new output until stop is closed.
+func PrintRunLogs(w io.Writer, cronicleFile string, scheduleName string, taskName string, t time.Time, follow bool, stop <-chan struct{}) error {
+	cronicleFileAbs, err := filepath.Abs(cronicleFile)
+	if err != nil {
+		return err
+	}
+	croniclePath := filepath.Dir(cronicleFileAbs)
+
+	var runDir string
+	if t.IsZero() {
+		taskDir := filepath.Join(croniclePath, ".cronicle", "runs", scheduleName, taskName)
+		runs := runLogRuns(taskDir)
+		if len(runs) == 0 {
+			return fmt.Errorf("no run logs found for schedule %q task %q", scheduleName, taskName)
+		}
+		runDir = filepath.Join(taskDir, runs[len(runs)-1])
+	} else {
+		runDir = RunLogDir(croniclePath, scheduleName, taskName, t)
+	}
+
+	attempts := runLogAttempts(runDir)
+	if len(attempts) == 0 {
+		return fmt.Errorf("no run logs found at %s", runDir)
+	}
+
+	var last *os.File
+	defer func() {
+		if last != nil {
+			last.Close()
+		}
+	}()
+	printed := 0
+	for {
+		//print any attempt logs written since the last pass, keeping the last attempt open
+		for _, attempt := range attempts[printed:] {
+			if last != nil {
+				if _, err := io.Copy(w, last); err != nil {
+					return err
+				}
+				last.Close()
+			}
+			if len(attempts) > 1 {
+				fmt.Fprintf(w, "==> attempt %s <==\n", strings.TrimSuffix(attempt, ".log"))
+			}
+			if last, err = os.Open(filepath.Join(runDir, attempt)); err != nil {
+				return err
+			}
+			printed++
+		}
+		if _, err := io.Copy(w, last); err != nil {
+			return err
+		}
+
+		if !follow {
+			return nil
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(500 * time.Millisecond):
+		}
+		attempts = runLogAttempts(runDir)
+	}
+}
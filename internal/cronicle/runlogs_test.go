@@ -0,0 +1,131 @@
+package cronicle_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	log "github.com/sirupsen/logrus"
+)
+
+var _ = Describe("RunLogs", func() {
+	var runLogsPath string
+	var cronicleFile string
+	var schedule cronicle.Schedule
+	t, _ := time.Parse(time.RFC3339, "2020-11-01T22:08:41+00:00")
+
+	BeforeEach(func() {
+		runLogsPath, _ = filepath.Abs("./test_runlogs/")
+		os.MkdirAll(runLogsPath, 0777)
+		cronicleFile = filepath.Join(runLogsPath, "cronicle.hcl")
+		schedule = cronicle.Default().Schedules[0]
+		schedule.PropigateTaskProperties(runLogsPath)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(runLogsPath)
+	})
+
+	It("task.Execute should write the output of each attempt to .cronicle/runs", func() {
+		task := schedule.Tasks[0]
+		task.Command = []string{"/bin/bash", "-c", "echo out; echo err >&2; exit 1"}
+		task.Retry = &cronicle.Retry{Count: 2}
+		task.Execute(t)
+
+		for attempt := 1; attempt <= 2; attempt++ {
+			b, err := ioutil.ReadFile(cronicle.RunLogPath(runLogsPath, "foo", "bar", t, attempt))
+			Expect(err).To(BeNil())
+			Expect(string(b)).To(ContainSubstring("out\n"))
+			Expect(string(b)).To(ContainSubstring("err\n"))
+		}
+	})
+
+	It("task.Execute should append to the run log of another run of the same scheduled time", func() {
+		task := schedule.Tasks[0]
+		task.Command = []string{"/bin/bash", "-c", "echo first"}
+		task.Execute(t)
+		task.Command = []string{"/bin/bash", "-c", "echo second"}
+		task.Execute(t)
+
+		b, err := ioutil.ReadFile(cronicle.RunLogPath(runLogsPath, "foo", "bar", t, 1))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal("first\nsecond\n"))
+	})
+
+	It("task.Execute should stream the output lines to the log as well as the run log", func() {
+		var logged bytes.Buffer
+		log.SetOutput(&logged)
+		defer log.SetOutput(os.Stderr)
+		task := schedule.Tasks[0]
+		task.Command = []string{"/bin/bash", "-c", "echo streamed"}
+		task.Execute(t)
+
+		Expect(logged.String()).To(ContainSubstring("msg=streamed"))
+		b, err := ioutil.ReadFile(cronicle.RunLogPath(runLogsPath, "foo", "bar", t, 1))
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal("streamed\n"))
+	})
+
+	It("cronicle.PrintRunLogs should print the latest run with a header per attempt", func() {
+		task := schedule.Tasks[0]
+		task.Command = []string{"/bin/bash", "-c", "echo old"}
+		task.Execute(t)
+		task.Command = []string{"/bin/bash", "-c", "echo attempt; exit 1"}
+		task.Retry = &cronicle.Retry{Count: 2}
+		task.Execute(t.Add(time.Hour))
+
+		var buf bytes.Buffer
+		err := cronicle.PrintRunLogs(&buf, cronicleFile, "foo", "bar", time.Time{}, false, nil)
+		Expect(err).To(BeNil())
+		Expect(buf.String()).To(Equal("==> attempt 1 <==\nattempt\n==> attempt 2 <==\nattempt\n"))
+
+		buf.Reset()
+		err = cronicle.PrintRunLogs(&buf, cronicleFile, "foo", "bar", t, false, nil)
+		Expect(err).To(BeNil())
+		Expect(buf.String()).To(Equal("old\n"))
+	})
+
+	It("cronicle.PrintRunLogs should error if there are no run logs", func() {
+		var buf bytes.Buffer
+		err := cronicle.PrintRunLogs(&buf, cronicleFile, "foo", "bar", time.Time{}, false, nil)
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("schedule.PruneRunLogs should keep the most recent max_runs runs", func() {
+		for i := 0; i < 3; i++ {
+			schedule.Tasks[0].Execute(t.Add(time.Duration(i) * time.Hour))
+		}
+		schedule.RunLogs = &cronicle.RunLogs{MaxRuns: 2}
+		schedule.PruneRunLogs(t)
+
+		_, err := os.Stat(cronicle.RunLogDir(runLogsPath, "foo", "bar", t))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		_, err = os.Stat(cronicle.RunLogDir(runLogsPath, "foo", "bar", t.Add(2*time.Hour)))
+		Expect(err).To(BeNil())
+	})
+
+	It("schedule.PruneRunLogs should remove runs older than the retention", func() {
+		schedule.Tasks[0].Execute(t)
+		schedule.Tasks[0].Execute(t.Add(48 * time.Hour))
+		schedule.RunLogs = &cronicle.RunLogs{Retention: "24h"}
+		schedule.PruneRunLogs(t.Add(49 * time.Hour))
+
+		_, err := os.Stat(cronicle.RunLogDir(runLogsPath, "foo", "bar", t))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+		_, err = os.Stat(cronicle.RunLogDir(runLogsPath, "foo", "bar", t.Add(48*time.Hour)))
+		Expect(err).To(BeNil())
+	})
+
+	It("conf.PropigateTaskProperties should inherit the config run_logs and conf.Validate should check retention", func() {
+		conf := cronicle.Default()
+		conf.RunLogs = &cronicle.RunLogs{Retention: "a week"}
+		conf.PropigateTaskProperties(runLogsPath)
+		Expect(conf.Schedules[0].RunLogs).To(Equal(conf.RunLogs))
+		Expect(conf.Validate()).ToNot(BeNil())
+	})
+})
@@ -0,0 +1,102 @@
+package cronicle
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+//Trigger rules decide if a task executes given the final states of the tasks it depends on.
+//A task that is not triggered is skipped, which is in turn the state seen by its dependents.
+const (
+	//TriggerAllSuccess executes the task if all dependencies succeeded [default]
+	TriggerAllSuccess = "all_success"
+	//TriggerAllDone executes the task once all dependencies are done, regardless of their state
+	TriggerAllDone = "all_done"
+	//TriggerOneFailed executes the task if at least one dependency failed
+	TriggerOneFailed = "one_failed"
+	//TriggerOneSuccess executes the task if at least one dependency succeeded
+	TriggerOneSuccess = "one_success"
+	//TriggerNoneFailed executes the task if no dependency failed, i.e. all succeeded or were skipped
+	TriggerNoneFailed = "none_failed"
+)
+
+//taskStates holds the final state [StatusSuccess, StatusFailed, StatusSkipped]
+//and the outputs of each task in a schedule run, it is safe for use by the concurrent DAG walk.
+type taskStates struct {
+	mu      sync.Mutex
+	states  map[string]string
+	outputs map[string]map[string]string
+}
+
+func newTaskStates() *taskStates {
+	return &taskStates{states: make(map[string]string), outputs: make(map[string]map[string]string)}
+}
+
+func (s *taskStates) set(taskName string, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[taskName] = state
+}
+
+func (s *taskStates) get(taskName string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.states[taskName]
+}
+
+//names returns the sorted names of the tasks in the given state
+func (s *taskStates) names(state string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := []string{}
+	for name, st := range s.states {
+		if st == state {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+//triggered evaluates task.TriggerRule against the final states of task.Depends.
+//If the task should not execute, the reason is returned with false.
+//A task without dependencies is always triggered.
+func (task *Task) triggered(states *taskStates) (bool, string) {
+	if len(task.Depends) == 0 {
+		return true, ""
+	}
+	var success, failed, skipped int
+	for _, dep := range task.Depends {
+		switch states.get(dep) {
+		case StatusSuccess:
+			success++
+		case StatusSkipped:
+			skipped++
+		default:
+			failed++
+		}
+	}
+
+	rule := task.TriggerRule
+	if rule == "" {
+		rule = TriggerAllSuccess
+	}
+	var ok bool
+	switch rule {
+	case TriggerAllSuccess:
+		ok = success == len(task.Depends)
+	case TriggerAllDone:
+		ok = true
+	case TriggerOneFailed:
+		ok = failed > 0
+	case TriggerOneSuccess:
+		ok = success > 0
+	case TriggerNoneFailed:
+		ok = failed == 0
+	}
+	if ok {
+		return true, ""
+	}
+	return false, fmt.Sprintf("trigger_rule %s not met: %d succeeded, %d failed, %d skipped upstream", rule, success, failed, skipped)
+}
@@ -0,0 +1,96 @@
+package cronicle_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Trigger", func() {
+	var triggerPath string
+	var schedule cronicle.Schedule
+	t, _ := time.Parse(time.RFC3339, "2020-11-01T22:08:41+00:00")
+
+	//taskStatuses executes the schedule and returns the recorded status of each task
+	taskStatuses := func() map[string]string {
+		schedule.PropigateTaskProperties(triggerPath)
+		schedule.Now = t
+		schedule.ExecuteTasks()
+		records, err := cronicle.NewHistory(triggerPath).Query(cronicle.HistoryFilter{Schedule: "foo"})
+		Expect(err).To(BeNil())
+		statuses := map[string]string{}
+		for _, rec := range records {
+			if rec.Kind == cronicle.RunKindTask {
+				statuses[rec.Task] = rec.Status
+			} else {
+				statuses[""] = rec.Status
+			}
+		}
+		return statuses
+	}
+
+	BeforeEach(func() {
+		triggerPath, _ = filepath.Abs("./test_trigger/")
+		os.MkdirAll(triggerPath, 0777)
+		schedule = cronicle.Schedule{Name: "foo"}
+		schedule.Tasks = []cronicle.Task{
+			{Name: "extract", Command: []string{"/bin/bash", "-c", "exit 1"}},
+			{Name: "load", Command: []string{"/bin/echo", "load"}, Depends: []string{"extract"}},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(triggerPath)
+	})
+
+	It("all_success should skip dependents of a failed task and fail the schedule", func() {
+		statuses := taskStatuses()
+		Expect(statuses["extract"]).To(Equal(cronicle.StatusFailed))
+		Expect(statuses["load"]).To(Equal(cronicle.StatusSkipped))
+		Expect(statuses[""]).To(Equal(cronicle.StatusFailed))
+	})
+
+	It("all_done should execute a cleanup task after a failed task", func() {
+		schedule.Tasks = append(schedule.Tasks, cronicle.Task{
+			Name: "cleanup", Command: []string{"/bin/echo", "cleanup"}, Depends: []string{"extract", "load"}, TriggerRule: cronicle.TriggerAllDone,
+		})
+		statuses := taskStatuses()
+		Expect(statuses["load"]).To(Equal(cronicle.StatusSkipped))
+		Expect(statuses["cleanup"]).To(Equal(cronicle.StatusSuccess))
+		Expect(statuses[""]).To(Equal(cronicle.StatusFailed))
+	})
+
+	It("one_failed should only execute if an upstream task failed", func() {
+		schedule.Tasks = append(schedule.Tasks,
+			cronicle.Task{Name: "alert", Command: []string{"/bin/echo", "alert"}, Depends: []string{"extract"}, TriggerRule: cronicle.TriggerOneFailed},
+			cronicle.Task{Name: "noop", Command: []string{"/bin/echo", "noop"}, Depends: []string{"load"}, TriggerRule: cronicle.TriggerOneFailed},
+		)
+		statuses := taskStatuses()
+		Expect(statuses["alert"]).To(Equal(cronicle.StatusSuccess))
+		Expect(statuses["noop"]).To(Equal(cronicle.StatusSkipped))
+	})
+
+	It("one_success and none_failed should treat skipped upstream tasks as not failed", func() {
+		schedule.Tasks[0].Command = []string{"/bin/echo", "extract"}
+		schedule.Tasks = append(schedule.Tasks,
+			cronicle.Task{Name: "alert", Command: []string{"/bin/echo", "alert"}, Depends: []string{"extract"}, TriggerRule: cronicle.TriggerOneFailed},
+			cronicle.Task{Name: "report", Command: []string{"/bin/echo", "report"}, Depends: []string{"alert", "load"}, TriggerRule: cronicle.TriggerNoneFailed},
+			cronicle.Task{Name: "publish", Command: []string{"/bin/echo", "publish"}, Depends: []string{"alert", "load"}, TriggerRule: cronicle.TriggerOneSuccess},
+		)
+		statuses := taskStatuses()
+		Expect(statuses["alert"]).To(Equal(cronicle.StatusSkipped))
+		Expect(statuses["report"]).To(Equal(cronicle.StatusSuccess))
+		Expect(statuses["publish"]).To(Equal(cronicle.StatusSuccess))
+		Expect(statuses[""]).To(Equal(cronicle.StatusSuccess))
+	})
+
+	It("conf.Validate() should error on an unknown trigger_rule", func() {
+		conf := cronicle.Default()
+		conf.Schedules[0].Tasks[0].TriggerRule = "sometimes"
+		Expect(conf.Validate()).ToNot(BeNil())
+	})
+})
@@ -0,0 +1,308 @@
+package cronicle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+//Version of cronicle, set at build time with -ldflags "-X github.com/jshiv/cronicle/internal/cronicle.Version=v0.4.0"
+var Version = "dev"
+
+//Worker states given by WorkerStatus.State
+const (
+	//WorkerAlive is a worker that heartbeat within workerDeadAfter
+	WorkerAlive = "alive"
+	//WorkerDead is a worker that has not heartbeat within workerDeadAfter
+	WorkerDead = "dead"
+	//WorkerDraining is a worker that stopped consuming and waits for its runs in flight
+	WorkerDraining = "draining"
+	//WorkerStopped is a worker that exited after it drained
+	WorkerStopped = "stopped"
+)
+
+const (
+	//workerHeartbeatInterval is the interval at which workers report their status
+	workerHeartbeatInterval = 10 * time.Second
+	//workerDeadAfter is the time without a heartbeat after which a worker is dead
+	workerDeadAfter = 3 * workerHeartbeatInterval
+	//workerForgetAfter is the time without a heartbeat after which a dead worker is no longer listed
+	workerForgetAfter = 24 * time.Hour
+)
+
+var workersBucket = []byte("workers")
+
+//WorkerStatus is the registration and heartbeat of a worker
+type WorkerStatus struct {
+	ID       string
+	Hostname string
+	Labels   []string
+	Version  string
+	Started  time.Time
+	LastSeen time.Time
+	//Runs are the schedule runs the worker is executing
+	Runs []WorkerRun
+	//Draining is set once the worker received SIGTERM and stopped consuming
+	Draining bool `json:",omitempty"`
+	//Stopped is set by the last heartbeat of a worker that exited
+	Stopped bool `json:",omitempty"`
+}
+
+//WorkerRun is a schedule run in flight on a worker
+type WorkerRun struct {
+	RunID    string
+	Schedule string
+	//Task is the dispatched task of the run the worker is executing, empty if it executes the whole schedule
+	Task    string `json:",omitempty"`
+	Started time.Time
+}
+
+//State returns WorkerStopped if the worker exited, WorkerDead if it has not heartbeat within
+//workerDeadAfter of now, otherwise WorkerDraining if it is draining or WorkerAlive
+func (status WorkerStatus) State(now time.Time) string {
+	switch {
+	case status.Stopped:
+		return WorkerStopped
+	case now.Sub(status.LastSeen) > workerDeadAfter:
+		return WorkerDead
+	case status.Draining:
+		return WorkerDraining
+	}
+	return WorkerAlive
+}
+
+//worker tracks the status of this process as a worker
+type worker struct {
+	mu     sync.Mutex
+	status WorkerStatus
+	runs   map[string]WorkerRun
+}
+
+//localWorker is the worker status of this process
+var localWorker = &worker{runs: map[string]WorkerRun{}}
+
+//begin tracks a schedule run, or a dispatched task of a run, in flight and returns the func that ends it
+func (w *worker) begin(schedule Schedule, task string) func() {
+	key := dispatchID(schedule.RunID, task)
+	if schedule.RunID == "" {
+		key = newID()
+	}
+	w.mu.Lock()
+	w.runs[key] = WorkerRun{RunID: schedule.RunID, Schedule: schedule.Name, Task: task, Started: time.Now()}
+	w.mu.Unlock()
+	return func() {
+		w.mu.Lock()
+		delete(w.runs, key)
+		w.mu.Unlock()
+	}
+}
+
+//setState marks the worker as draining or stopped and returns its status at now
+func (w *worker) setState(draining bool, stopped bool, now time.Time) WorkerStatus {
+	w.mu.Lock()
+	w.status.Draining = draining
+	w.status.Stopped = stopped
+	w.mu.Unlock()
+	return w.heartbeat(now)
+}
+
+//heartbeat returns the current status of the worker
+func (w *worker) heartbeat(now time.Time) WorkerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	status := w.status
+	status.LastSeen = now
+	status.Runs = []WorkerRun{}
+	for _, run := range w.runs {
+		status.Runs = append(status.Runs, run)
+	}
+	sort.Slice(status.Runs, func(i, j int) bool { return status.Runs[i].Started.Before(status.Runs[j].Started) })
+	return status
+}
+
+//startHeartbeats registers this process as a worker of the cronicle path with the given labels
+//and reports its status every workerHeartbeatInterval until the process exits
+func startHeartbeats(path string, labels []string) {
+	hostname, _ := os.Hostname()
+	localWorker.mu.Lock()
+	localWorker.status = WorkerStatus{
+		ID:       workerID,
+		Hostname: hostname,
+		Labels:   labels,
+		Version:  Version,
+		Started:  time.Now(),
+	}
+	localWorker.mu.Unlock()
+	log.WithFields(log.Fields{"worker": workerID, "labels": strings.Join(labels, ","), "version": Version}).Info("Registering worker...")
+
+	status := localWorker.heartbeat(time.Now())
+	report(RunResult{CroniclePath: path, Worker: &status})
+	for now := range time.Tick(workerHeartbeatInterval) {
+		status := localWorker.heartbeat(now)
+		report(RunResult{CroniclePath: path, Worker: &status})
+	}
+}
+
+//registry is the last status of each worker reported to this process
+type registry struct {
+	mu      sync.Mutex
+	workers map[string]WorkerStatus
+}
+
+//workerRegistry holds the workers reported to the cronicle run node
+var workerRegistry = &registry{workers: map[string]WorkerStatus{}}
+
+//update stores the status of a worker
+func (r *registry) update(status WorkerStatus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.workers[status.ID] = status
+}
+
+//list returns the workers seen within workerForgetAfter of now, ordered by ID
+func (r *registry) list(now time.Time) []WorkerStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	workers := []WorkerStatus{}
+	for id, status := range r.workers {
+		if now.Sub(status.LastSeen) > workerForgetAfter {
+			delete(r.workers, id)
+			continue
+		}
+		workers = append(workers, status)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].ID < workers[j].ID })
+	return workers
+}
+
+//SetWorker stores the status of a worker, workers not seen within workerForgetAfter are removed
+func (h *History) SetWorker(status WorkerStatus) error {
+	return h.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(workersBucket)
+		if err != nil {
+			return err
+		}
+		var forget [][]byte
+		err = b.ForEach(func(k, v []byte) error {
+			var prior WorkerStatus
+			if err := json.Unmarshal(v, &prior); err != nil || status.LastSeen.Sub(prior.LastSeen) > workerForgetAfter {
+				forget = append(forget, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range forget {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		v, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(status.ID), v)
+	})
+}
+
+//Workers returns the stored worker statuses, ordered by ID
+func (h *History) Workers() ([]WorkerStatus, error) {
+	workers := []WorkerStatus{}
+	err := h.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket(workersBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var status WorkerStatus
+			if err := json.Unmarshal(v, &status); err != nil {
+				return err
+			}
+			workers = append(workers, status)
+			return nil
+		})
+	})
+	return workers, err
+}
+
+//workerView is the api and json view of a worker with its state
+type workerView struct {
+	WorkerStatus
+	State string
+}
+
+func workerViews(workers []WorkerStatus, now time.Time) []workerView {
+	views := []workerView{}
+	for _, status := range workers {
+		views = append(views, workerView{WorkerStatus: status, State: status.State(now)})
+	}
+	return views
+}
+
+//handleWorkers lists the workers reported to the scheduler
+func handleWorkers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+	now := time.Now()
+	writeJSON(w, http.StatusOK, workerViews(workerRegistry.list(now), now))
+}
+
+//PrintWorkers lists the workers recorded in the history store kept next to cronicleFile
+//and writes them to w as a table or as json.
+func PrintWorkers(w io.Writer, cronicleFile string, format string) error {
+	cronicleFileAbs, err := filepath.Abs(cronicleFile)
+	if err != nil {
+		return err
+	}
+	workers, err := NewHistory(filepath.Dir(cronicleFileAbs)).Workers()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	views := workerViews(workers, now)
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(views)
+	case "table", "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tVERSION\tLABELS\tSTATE\tLAST SEEN\tRUNS")
+		for _, view := range views {
+			runs := []string{}
+			for _, run := range view.Runs {
+				if run.Task != "" {
+					runs = append(runs, run.Schedule+"/"+run.Task)
+					continue
+				}
+				runs = append(runs, run.Schedule)
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				view.ID,
+				view.Version,
+				strings.Join(view.Labels, ","),
+				view.State,
+				now.Sub(view.LastSeen).Round(time.Second),
+				strings.Join(runs, ","),
+			)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q, options are table and json", format)
+	}
+}
@@ -0,0 +1,92 @@
+package cronicle_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jshiv/cronicle/internal/cronicle"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Workers", func() {
+	var workersPath string
+	now := time.Now()
+
+	report := func(status cronicle.WorkerStatus) {
+		queue := make(chan []byte, 1)
+		cronicle.QueueReporter{Queue: queue}.Report(cronicle.RunResult{Worker: &status})
+		close(queue)
+		cronicle.ConsumeResults(queue, cronicle.LocalReporter{CroniclePath: workersPath})
+	}
+
+	BeforeEach(func() {
+		workersPath, _ = filepath.Abs("./test_workers/")
+		os.MkdirAll(workersPath, 0777)
+		report(cronicle.WorkerStatus{
+			ID:       "host1:1",
+			Hostname: "host1",
+			Labels:   []string{"gpu"},
+			Version:  "v1",
+			LastSeen: now,
+			Runs:     []cronicle.WorkerRun{{RunID: "run1", Schedule: "foo", Started: now}},
+		})
+		report(cronicle.WorkerStatus{ID: "host2:2", Hostname: "host2", Version: "v1", LastSeen: now.Add(-time.Minute)})
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(workersPath)
+	})
+
+	It("WorkerStatus.State should be dead after missed heartbeats", func() {
+		status := cronicle.WorkerStatus{LastSeen: now}
+		Expect(status.State(now.Add(5 * time.Second))).To(Equal(cronicle.WorkerAlive))
+		Expect(status.State(now.Add(time.Minute))).To(Equal(cronicle.WorkerDead))
+	})
+
+	It("GET /api/workers should list the reported workers with their state and runs", func() {
+		w := httptest.NewRecorder()
+		cronicle.APIHandler().ServeHTTP(w, httptest.NewRequest("GET", "/api/workers", nil))
+		var workers []struct {
+			cronicle.WorkerStatus
+			State string
+		}
+		Expect(json.Unmarshal(w.Body.Bytes(), &workers)).To(BeNil())
+		byID := map[string]string{}
+		for _, worker := range workers {
+			byID[worker.ID] = worker.State
+			if worker.ID == "host1:1" {
+				Expect(worker.Labels).To(Equal([]string{"gpu"}))
+				Expect(worker.Runs[0].Schedule).To(Equal("foo"))
+			}
+		}
+		Expect(byID["host1:1"]).To(Equal(cronicle.WorkerAlive))
+		Expect(byID["host2:2"]).To(Equal(cronicle.WorkerDead))
+	})
+
+	It("cronicle.PrintWorkers should list the workers recorded by the scheduler", func() {
+		workers, err := cronicle.NewHistory(workersPath).Workers()
+		Expect(err).To(BeNil())
+		Expect(len(workers)).To(Equal(2))
+
+		var buf bytes.Buffer
+		Expect(cronicle.PrintWorkers(&buf, filepath.Join(workersPath, "cronicle.hcl"), "table")).To(BeNil())
+		Expect(buf.String()).To(ContainSubstring("host1:1"))
+		Expect(buf.String()).To(ContainSubstring("gpu"))
+		Expect(buf.String()).To(ContainSubstring("foo"))
+		Expect(buf.String()).To(ContainSubstring(cronicle.WorkerDead))
+	})
+
+	It("History.SetWorker should forget workers not seen for a day", func() {
+		h := cronicle.NewHistory(workersPath)
+		Expect(h.SetWorker(cronicle.WorkerStatus{ID: "host3:3", LastSeen: now.Add(48 * time.Hour)})).To(BeNil())
+		workers, err := h.Workers()
+		Expect(err).To(BeNil())
+		Expect(len(workers)).To(Equal(1))
+		Expect(workers[0].ID).To(Equal("host3:3"))
+	})
+})
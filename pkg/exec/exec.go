@@ -1,10 +1,11 @@
 package exec
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"os"
 	goexec "os/exec"
+	"sync"
 	"syscall"
 )
 
@@ -17,12 +18,36 @@ type Result struct {
 	Stderr     string
 	ExitStatus int
 	Error      error
+	//TimedOut is true if the command was killed because the context deadline was exceeded
+	TimedOut bool
+	//Truncated is true if Stdout or Stderr was capped to the tail of Options.MaxOutput bytes
+	Truncated bool
 }
 
+//Options configures the handling of command output in ExecuteContext
+type Options struct {
+	//OnLine is called with each line of stdout and stderr as it is written by the command.
+	//Calls are serialized in the order the lines are read, preserving the interleaving of the streams.
+	OnLine func(stream string, line string)
+	//MaxOutput caps the bytes of stdout and of stderr retained in Result to the last MaxOutput bytes,
+	//0 retains all output.
+	MaxOutput int
+}
+
+//ErrTimeout is the Result.Error of a command that was killed on the context deadline
+var ErrTimeout = errors.New("command timed out")
+
 //Execute executes a given command []string at dir path and returns the results as a Result struct.
-//TODO: Add method for running command that does not collect stdout, just writes to stdout
-// in order to handle complex/verbose logging
+//Use ExecuteContext to stream the output of complex/verbose commands.
 func Execute(command []string, dir string, env []string) Result {
+	return ExecuteContext(context.Background(), command, dir, env, Options{})
+}
+
+//ExecuteContext executes a given command []string at dir path and returns the results as a Result struct.
+//The command runs in its own process group, which is killed if ctx is done before the command exits.
+//Result.Error is then ctx.Err(), or ErrTimeout with Result.TimedOut if the ctx deadline was exceeded.
+//stdout and stderr are read line by line as they are written and passed to opts.OnLine.
+func ExecuteContext(ctx context.Context, command []string, dir string, env []string, opts Options) Result {
 	var result Result
 	result.Command = command
 	var cmd *goexec.Cmd
@@ -32,6 +57,7 @@ func Execute(command []string, dir string, env []string) Result {
 	default:
 		cmd = goexec.Command(command[0], command[1:]...)
 	}
+	setProcessGroup(cmd)
 	cmd.Dir = dir
 	cmd.Env = os.Environ()
 	for _, e := range env {
@@ -44,18 +70,38 @@ func Execute(command []string, dir string, env []string) Result {
 		return result
 	}
 	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		result.Error = err
+		return result
+	}
 	if err := cmd.Start(); err != nil {
 		result.Error = err
 		return result
 	}
 
-	bb := bytes.NewBuffer([]byte{})
-	_, err = bb.ReadFrom(stdout)
-	result.Stdout = bb.String()
+	//Kill the process group once ctx is done so that children holding the pipes exit too
+	exited := make(chan struct{})
+	defer close(exited)
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessGroup(cmd)
+		case <-exited:
+		}
+	}()
 
-	be := bytes.NewBuffer([]byte{})
-	_, err = be.ReadFrom(stderr)
+	//Read both streams concurrently so that a command filling one pipe can not block on the other
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	bo := newTailBuffer(opts.MaxOutput)
+	be := newTailBuffer(opts.MaxOutput)
+	wg.Add(2)
+	go streamLines(stdout, Stdout, bo, &mu, &wg, opts.OnLine)
+	go streamLines(stderr, Stderr, be, &mu, &wg, opts.OnLine)
+	wg.Wait()
+	result.Stdout = bo.String()
 	result.Stderr = be.String()
+	result.Truncated = bo.truncated || be.truncated
 
 	var waitStatus syscall.WaitStatus
 	if err := cmd.Wait(); err != nil {
@@ -70,6 +116,15 @@ func Execute(command []string, dir string, env []string) Result {
 		result.ExitStatus = waitStatus.ExitStatus()
 	}
 
+	switch ctx.Err() {
+	case nil:
+	case context.DeadlineExceeded:
+		result.TimedOut = true
+		result.Error = ErrTimeout
+	default:
+		result.Error = ctx.Err()
+	}
+
 	if result.Error == nil {
 		result.Error = exitStatusError(result)
 	}
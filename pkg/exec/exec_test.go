@@ -1,7 +1,9 @@
 package exec
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -45,4 +47,67 @@ var _ = Describe("exec", func() {
 		Expect(res).To(Equal(expected))
 		Expect(err).To(Equal(exitError))
 	})
+
+	It("ExecuteContext should kill the command once the context is cancelled", func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			cancel()
+		}()
+		then := time.Now()
+		res := ExecuteContext(ctx, []string{"/bin/sleep", "2"}, "./", []string{}, Options{})
+		Expect(time.Since(then).Seconds()).To(BeNumerically("<", 2))
+		Expect(res.Error).To(Equal(context.Canceled))
+	})
+
+	It("ExecuteContext should kill the process group and set TimedOut once the deadline is exceeded", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		then := time.Now()
+		res := ExecuteContext(ctx, []string{"/bin/sh", "-c", "sleep 3 & wait"}, "./", []string{}, Options{})
+		Expect(time.Since(then).Seconds()).To(BeNumerically("<", 2))
+		Expect(res.TimedOut).To(BeTrue())
+		Expect(res.Error).To(Equal(ErrTimeout))
+	})
+
+	It("ExecuteContext should stream stdout and stderr lines to OnLine in the order they are written", func() {
+		lines := []string{}
+		opts := Options{OnLine: func(stream string, line string) {
+			lines = append(lines, stream+": "+line)
+		}}
+		script := "echo one; sleep 0.1; echo two >&2; sleep 0.1; echo three"
+		res := ExecuteContext(context.Background(), []string{"/bin/sh", "-c", script}, "./", []string{}, opts)
+		Expect(res.Error).To(BeNil())
+		Expect(lines).To(Equal([]string{"stdout: one", "stderr: two", "stdout: three"}))
+		Expect(res.Stdout).To(Equal("one\nthree\n"))
+		Expect(res.Stderr).To(Equal("two\n"))
+	})
+
+	It("ExecuteContext should not deadlock when stderr fills the pipe before stdout is written", func() {
+		script := "head -c 200000 /dev/zero >&2; echo done"
+		res := ExecuteContext(context.Background(), []string{"/bin/sh", "-c", script}, "./", []string{}, Options{})
+		Expect(res.Error).To(BeNil())
+		Expect(res.Stdout).To(Equal("done\n"))
+		Expect(len(res.Stderr)).To(Equal(200000))
+	})
+
+	It("ExecuteContext should pass a line longer than maxLineLength to OnLine in parts", func() {
+		lengths := []int{}
+		opts := Options{OnLine: func(stream string, line string) {
+			lengths = append(lengths, len(line))
+		}}
+		script := "head -c 150000 /dev/zero; echo"
+		res := ExecuteContext(context.Background(), []string{"/bin/sh", "-c", script}, "./", []string{}, opts)
+		Expect(res.Error).To(BeNil())
+		Expect(lengths).To(Equal([]int{maxLineLength, maxLineLength, 150000 - 2*maxLineLength}))
+		Expect(len(res.Stdout)).To(Equal(150001))
+	})
+
+	It("ExecuteContext should retain the tail of MaxOutput bytes", func() {
+		script := "echo aaaa; echo bbbb"
+		res := ExecuteContext(context.Background(), []string{"/bin/sh", "-c", script}, "./", []string{}, Options{MaxOutput: 5})
+		Expect(res.Error).To(BeNil())
+		Expect(res.Stdout).To(Equal("bbbb\n"))
+		Expect(res.Truncated).To(BeTrue())
+	})
 })
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package exec
+
+import (
+	goexec "os/exec"
+	"syscall"
+)
+
+//setProcessGroup starts cmd as the leader of a new process group
+func setProcessGroup(cmd *goexec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+//killProcessGroup kills cmd and every process in its process group
+func killProcessGroup(cmd *goexec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,13 @@
+package exec
+
+import (
+	goexec "os/exec"
+)
+
+//setProcessGroup is a no-op, windows does not have unix process groups
+func setProcessGroup(cmd *goexec.Cmd) {}
+
+//killProcessGroup kills cmd
+func killProcessGroup(cmd *goexec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,65 @@
+package exec
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+)
+
+const (
+	//Stdout names the standard output stream in Options.OnLine
+	Stdout = "stdout"
+	//Stderr names the standard error stream in Options.OnLine
+	Stderr = "stderr"
+)
+
+//maxLineLength caps the length of a line passed to Options.OnLine, the rest of
+//a longer line is passed in further calls
+const maxLineLength = 64 * 1024
+
+//tailBuffer retains the last max bytes written to it, max <= 0 retains everything
+type tailBuffer struct {
+	b         []byte
+	max       int
+	truncated bool
+}
+
+func newTailBuffer(max int) *tailBuffer {
+	return &tailBuffer{max: max}
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.b = append(t.b, p...)
+	if t.max > 0 && len(t.b) > t.max {
+		t.b = t.b[len(t.b)-t.max:]
+		t.truncated = true
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return string(t.b)
+}
+
+//streamLines reads r line by line into buf and onLine until EOF, mu serializes
+//the handling of lines across the streams of a command. Lines longer than
+//maxLineLength are flushed in parts so a command without newlines is not held in memory.
+func streamLines(r io.Reader, stream string, buf *tailBuffer, mu *sync.Mutex, wg *sync.WaitGroup, onLine func(stream string, line string)) {
+	defer wg.Done()
+	reader := bufio.NewReaderSize(r, maxLineLength)
+	for {
+		line, err := reader.ReadSlice('\n')
+		if len(line) > 0 {
+			mu.Lock()
+			buf.Write(line)
+			if onLine != nil {
+				onLine(stream, strings.TrimRight(string(line), "\r\n"))
+			}
+			mu.Unlock()
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return
+		}
+	}
+}